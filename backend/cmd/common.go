@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -17,20 +20,22 @@ type Content struct {
 }
 
 type ContentItem struct {
-	Word     string    `json:"word"`
-	Count    int       `json:"count"`
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+	// Score はタイトルに出てくる記事を記事の重み、本文だけに出てくる記事を記事の重みと本文の重みの積として数えた値
+	Score    float64   `json:"score,omitempty"`
 	Articles []Article `json:"articles"`
 }
 
 type Article struct {
 	Title string `json:"title"`
 	URL   string `json:"url"`
-}
-
-type YahooRSSFeed struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	// 以下は記事ページのOpenGraphなどから取得したメタデータ
+	OGTitle      string `json:"og_title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Image        string `json:"image,omitempty"`
+	CanonicalURL string `json:"canonical_url,omitempty"`
+	PublishedAt  string `json:"published_at,omitempty"`
 }
 
 // FetchInfo fetchした板の名前一覧情報
@@ -40,54 +45,119 @@ type FetchInfo struct {
 }
 
 type Board struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Category string `json:"category"`
 }
 
 type NewsArticleJSON struct {
-	Date     string `json:"date"`
-	URL      string `json:"url"`
-	Name     string `json:"name"`
-	Title    string `json:"title"`
-	Category string `json:"category"`
+	Date      string  `json:"date"`
+	URL       string  `json:"url"`
+	Name      string  `json:"name"`
+	Title     string  `json:"title"`
+	Category  string  `json:"category"`
+	Weight    float64 `json:"weight,omitempty"`
+	Language  string  `json:"language,omitempty"`
+	FirstSeen string  `json:"first_seen"`
+	LastSeen  string  `json:"last_seen"`
+	ResCount  int     `json:"res_count,omitempty"`
+	Momentum  float64 `json:"momentum,omitempty"`
 }
 
-func ReadYahooRSSFeed(path string) ([]YahooRSSFeed, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to open file: %s", path)
-	}
-	defer f.Close()
+// ArticleBody はニュース記事のページから抽出した本文を表す
+type ArticleBody struct {
+	URL  string `json:"url"`
+	Text string `json:"text"`
+}
 
-	var articles []YahooRSSFeed
-	d := json.NewDecoder(f)
-	for d.More() {
-		var article YahooRSSFeed
-		if err := d.Decode(&article); err != nil {
-			return nil, errors.Wrapf(err, "could not unmarshal: %v", article)
-		}
-		articles = append(articles, article)
-	}
-	return articles, nil
+// ArticleBodyFileName は記事JSONLのファイル名から本文JSONLのファイル名を返す
+// (例: rss.jsonl -> rss.body.jsonl)
+func ArticleBodyFileName(articleFileName string) string {
+	return strings.TrimSuffix(articleFileName, ".jsonl") + ".body.jsonl"
+}
+
+// Post は5chスレッドの1レスを表す
+type Post struct {
+	ThreadURL string `json:"thread_url"`
+	Number    int    `json:"number"`
+	Name      string `json:"name"`
+	Mail      string `json:"mail"`
+	Date      string `json:"date"`
+	ID        string `json:"id"`
+	Body      string `json:"body"`
+}
+
+// OutFile は出力先と同じディレクトリの一時ファイルに書き込み、Commitで出力先に置き換えるファイル
+type OutFile struct {
+	*os.File
+	path      string
+	committed bool
 }
 
 // CreateOutFile データ書き込み用のファイルを生成する
-func CreateOutFile(path string) (*os.File, error) {
+// 書き込みが途中で中断されても出力先のファイルが壊れないように、Commitするまでは一時ファイルに書き込む
+func CreateOutFile(path string) (*OutFile, error) {
 	dir := filepath.Dir(path)
 	err := os.MkdirAll(dir, os.ModePerm)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create output directory: %s", dir)
 	}
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp*")
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to open file: %s", path)
 	}
-	return f, nil
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, errors.Wrapf(err, "failed to chmod file: %s", f.Name())
+	}
+	return &OutFile{File: f, path: path}, nil
+}
+
+// Commit は一時ファイルを同期して閉じ、出力先のファイルに置き換える
+func (f *OutFile) Commit() error {
+	if err := f.File.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync file")
+	}
+	if err := f.File.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close file: %s", f.Name())
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		return errors.Wrapf(err, "failed to rename file: %s", f.path)
+	}
+	f.committed = true
+	return nil
+}
+
+// Close はCommitしていなければ一時ファイルを閉じて削除する。出力先のファイルは変更しない。
+func (f *OutFile) Close() error {
+	if f.committed {
+		return nil
+	}
+	f.File.Close()
+	if err := os.Remove(f.Name()); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to remove file: %s", f.Name())
+	}
+	return nil
+}
+
+// WriteOutFile はbをpathのファイルに一時ファイル経由で書き込む
+func WriteOutFile(path string, b []byte) error {
+	f, err := CreateOutFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return errors.Wrapf(err, "failed to write file: %s", path)
+	}
+	return f.Commit()
 }
 
 // AppendOutFile はファイルにJSONを追記する
-func AppendOutFile(f *os.File, v interface{}) error {
+func AppendOutFile(f io.Writer, v interface{}) error {
 	jsonl, err := toJSON(v)
 	if err != nil {
 		return err
@@ -108,10 +178,68 @@ func toJSON(r interface{}) (string, error) {
 }
 
 // ReadFileJSON はJSONを読み込んでoutputに入れる
+// gzipで圧縮されたファイルも読み込める
 func ReadFileJSON(file string, output interface{}) error {
-	bytes, err := ioutil.ReadFile(file)
+	bytes, err := ReadFile(file)
 	if err != nil {
 		return err
 	}
 	return json.Unmarshal(bytes, output)
 }
+
+// GzipExt はgzipで圧縮したファイルの拡張子
+const GzipExt = ".gz"
+
+// OpenFile はpathのファイルを開く。
+// pathが無くgzipで圧縮した path.gz がある場合は展開しながら読み込む。
+// どちらも無い場合はpathを開いた時のエラーを返す。
+func OpenFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err == nil {
+		if strings.HasSuffix(path, GzipExt) {
+			return newGzipReader(f, path)
+		}
+		return f, nil
+	}
+	if !os.IsNotExist(err) || strings.HasSuffix(path, GzipExt) {
+		return nil, err
+	}
+	gz, gzErr := os.Open(path + GzipExt)
+	if gzErr != nil {
+		return nil, err
+	}
+	return newGzipReader(gz, path+GzipExt)
+}
+
+// ReadFile はOpenFileと同様に圧縮の有無に関わらずファイルの内容を読み込む
+func ReadFile(path string) ([]byte, error) {
+	r, err := OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// gzipReader はgzipを展開しながら読み込み、Closeで元のファイルも閉じる
+type gzipReader struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func newGzipReader(f *os.File, path string) (io.ReadCloser, error) {
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "failed to read gzip file: %s", path)
+	}
+	return &gzipReader{Reader: zr, f: f}, nil
+}
+
+func (r *gzipReader) Close() error {
+	err := r.Reader.Close()
+	if closeErr := r.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FeedListFileName はフィード一覧ファイルの名前
+const FeedListFileName = "rss.jsonl"
+
+// Feed はfetch対象のRSS/Atomフィードを表す
+type Feed struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Category はフィードのカテゴリ(エンタメ、スポーツなど)
+	Category string `json:"category,omitempty"`
+	// Weight は分析時の記事の重み。未指定の場合は1
+	Weight float64 `json:"weight"`
+	// Language はフィードの言語(ja、enなど)
+	Language string `json:"language,omitempty"`
+	// Enabled がfalseのフィードはfetch、transformの対象外になる。未指定の場合はtrue
+	Enabled bool `json:"enabled"`
+}
+
+// NewFeed はデフォルトのメタデータを持つFeedを生成する
+func NewFeed(id, name, url string) Feed {
+	return Feed{ID: id, Name: name, URL: url, Weight: 1, Enabled: true}
+}
+
+// UnmarshalJSON はメタデータを持たない古いフィード一覧も読めるよう未指定の項目にデフォルト値を入れる
+func (f *Feed) UnmarshalJSON(b []byte) error {
+	type feed Feed
+	v := feed(NewFeed("", "", ""))
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*f = Feed(v)
+	return nil
+}
+
+// FeedListPath はdirにあるフィード一覧ファイルのパスを返す
+func FeedListPath(dir string) string {
+	return filepath.Join(dir, FeedListFileName)
+}
+
+// SitemapListFileName はニュースサイトマップ一覧ファイルの名前。
+// 一覧の各行はフィード一覧と同じ形式で、URLにサイトマップかサイトマップインデックスのURLを指定する
+const SitemapListFileName = "sitemap.jsonl"
+
+// SitemapListPath はdirにあるニュースサイトマップ一覧ファイルのパスを返す
+func SitemapListPath(dir string) string {
+	return filepath.Join(dir, SitemapListFileName)
+}
+
+// ReadFeeds はJSONLのフィード一覧ファイルを読み込む。
+// フィードIDは保存先のパスに使うので、手で編集した一覧などで不正なIDがあればエラーを返す
+func ReadFeeds(path string) ([]Feed, error) {
+	f, err := OpenFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open file: %s", path)
+	}
+	defer f.Close()
+
+	var feeds []Feed
+	d := json.NewDecoder(f)
+	for d.More() {
+		var feed Feed
+		if err := d.Decode(&feed); err != nil {
+			return nil, errors.Wrapf(err, "could not unmarshal: %v", feed)
+		}
+		if err := ValidateFeedID(feed.ID); err != nil {
+			return nil, errors.WithMessage(err, path)
+		}
+		feeds = append(feeds, feed)
+	}
+	return feeds, nil
+}
+
+// WriteFeeds はフィード一覧をJSONLでファイルに書き込む
+func WriteFeeds(path string, feeds []Feed) error {
+	f, err := CreateOutFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, feed := range feeds {
+		if err := AppendOutFile(f, feed); err != nil {
+			return err
+		}
+	}
+	return f.Commit()
+}
+
+// UpsertFeeds はfeedsにaddsを追加した一覧を返す。
+// IDかURLが同じフィードが既にある場合は、その位置のフィードを置き換える。
+func UpsertFeeds(feeds []Feed, adds ...Feed) []Feed {
+	ret := append([]Feed(nil), feeds...)
+	for _, add := range adds {
+		replaced := false
+		for i, f := range ret {
+			if f.ID == add.ID || f.URL == add.URL {
+				ret[i] = add
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			ret = append(ret, add)
+		}
+	}
+	return ret
+}
+
+// RemoveFeeds はIDかURLがkeysのいずれかに一致するフィードを除いた一覧と、除いた件数を返す
+func RemoveFeeds(feeds []Feed, keys ...string) ([]Feed, int) {
+	var ret []Feed
+	removed := 0
+	for _, f := range feeds {
+		match := false
+		for _, k := range keys {
+			if f.ID == k || f.URL == k {
+				match = true
+				break
+			}
+		}
+		if match {
+			removed++
+			continue
+		}
+		ret = append(ret, f)
+	}
+	return ret, removed
+}
+
+// FeedIDFromURL はフィードURLからフィードIDを生成する。
+// IDはfetchしたフィードの保存パスになるため、ホストとパスから拡張子を除いたものを使う。
+// 保存先のディレクトリの外を指さないよう、"."や".."だけのパスの要素は"_"に置き換える。
+func FeedIDFromURL(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed parse url : %s", rawurl)
+	}
+	if u.Host == "" {
+		return "", errors.Errorf("feed URL must be absolute : %s", rawurl)
+	}
+	p := strings.Trim(u.Path, "/")
+	p = strings.TrimSuffix(p, filepath.Ext(p))
+	if u.RawQuery != "" {
+		p += "_" + u.RawQuery
+	}
+	id := u.Host
+	if p != "" {
+		id += "/" + p
+	}
+	id = strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		case r == '.' || r == '-' || r == '_' || r == '/':
+			return r
+		default:
+			return '_'
+		}
+	}, id)
+	segments := strings.Split(id, "/")
+	for i, s := range segments {
+		if isDotSegment(s) {
+			segments[i] = strings.Repeat("_", len(s))
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// ValidateFeedID はフィードIDが保存先のディレクトリの外を指す場合にエラーを返す
+func ValidateFeedID(id string) error {
+	if id == "" || filepath.IsAbs(id) || strings.HasPrefix(id, "/") {
+		return errors.Errorf("invalid feed ID : %q", id)
+	}
+	for _, s := range strings.Split(id, "/") {
+		if isDotSegment(s) {
+			return errors.Errorf("invalid feed ID : %q", id)
+		}
+	}
+	return nil
+}
+
+// パスの要素が"."や".."のように"."だけからなればtrueを返す
+func isDotSegment(s string) bool {
+	return s != "" && strings.Trim(s, ".") == ""
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"time"
 
 	"github.com/ohnishi/nahaha/backend/common/command"
@@ -9,22 +10,24 @@ import (
 
 func transformRelateCommand() *cobra.Command {
 	var (
-		src   string
-		dest  string
-		dates []string
+		src        string
+		dest       string
+		dates      []string
+		bodyWeight float64
 	)
 
 	cmd := &cobra.Command{
 		Use:   "trends",
 		Short: "Transform relate thread",
 		RunE: command.WithLoggingE(func(cmd *cobra.Command, args []string) error {
-			return command.EachDate(dates, func(date time.Time) error {
-				return transformTrends(src, dest, date)
+			return command.EachDateContext(cmd.Context(), dates, func(date time.Time) error {
+				return transformTrends(src, dest, date, bodyWeight)
 			})
 		}),
 	}
 	cmd.PersistentFlags().StringVar(&src, "src", "~/Desktop", "dir to save spotify json")
 	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "dir to save spotify json")
+	cmd.PersistentFlags().Float64Var(&bodyWeight, "body-weight", 0, "weight of person names in article bodies (<file>.body.jsonl) relative to titles (disabled if 0)")
 	command.SetDatesFlag(cmd.Flags(), &dates, "date for which the URL list file(s) is generated")
 	_ = cmd.MarkFlagRequired("date")
 
@@ -32,12 +35,15 @@ func transformRelateCommand() *cobra.Command {
 }
 
 func main() {
+	ctx, cancel := command.SignalContext(context.Background())
+	defer cancel()
+
 	rootCmd := &cobra.Command{Use: "nahahaanalysis"}
 	rootCmd.AddCommand(
 		transformRelateCommand(),
 	)
 
-	err := rootCmd.Execute()
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		panic(err)
 	}
@@ -18,11 +18,13 @@ import (
 
 const ipadic = "/usr/local/lib/mecab/dic/mecab-ipadic-neologd"
 
-var newsArticleNames = []string{"rss.jsonl", "5ch.jsonl"}
+// trendsの集計対象にするnahahatransformが出力する記事ファイル
+var newsArticleNames = []string{"rss.jsonl", "sitemap.jsonl", "5ch.jsonl", "open2ch.jsonl", "shitaraba.jsonl"}
 
-func transformTrends(src, dest string, date time.Time) error {
+func transformTrends(src, dest string, date time.Time, bodyWeight float64) error {
 	dateStr := date.Format("20060102")
 	var articles []cmd.NewsArticleJSON
+	bodies := make(map[string]string)
 	for _, fileName := range newsArticleNames {
 		path := filepath.Join(src, dateStr, fileName)
 		a, err := readArticles(path)
@@ -31,9 +33,16 @@ func transformTrends(src, dest string, date time.Time) error {
 			continue
 		}
 		articles = append(articles, a...)
+
+		if bodyWeight > 0 {
+			bodyPath := filepath.Join(src, dateStr, cmd.ArticleBodyFileName(fileName))
+			if err := readArticleBodies(bodyPath, bodies); err != nil {
+				fmt.Println("failed to open article body file.", zap.String("path", bodyPath), zap.Error(err))
+			}
+		}
 	}
 
-	contentItems := toContents(articles)
+	contentItems := toContents(articles, bodies, bodyWeight)
 	if len(contentItems) >= 30 {
 		contentItems = contentItems[:30]
 	}
@@ -62,10 +71,7 @@ func writeContent(dest, fileName string, c cmd.Content) error {
 		return err
 	}
 
-	if err := f.Sync(); err != nil {
-		return errors.Wrap(err, "failed to sync file")
-	}
-	return nil
+	return f.Commit()
 }
 
 // ニュース記事情報となるJSONLファイルをreadして返す
@@ -88,7 +94,29 @@ func readArticles(path string) ([]cmd.NewsArticleJSON, error) {
 	return articles, nil
 }
 
-func toContents(articles []cmd.NewsArticleJSON) []cmd.ContentItem {
+// 記事本文のJSONLファイルを読み込んでURLごとの本文をbodiesに入れる
+func readArticleBodies(path string, bodies map[string]string) error {
+	f, err := cmd.OpenFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open file: %s", path)
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	for d.More() {
+		var body cmd.ArticleBody
+		if err := d.Decode(&body); err != nil {
+			return errors.Wrapf(err, "could not unmarshal: %v", body)
+		}
+		bodies[body.URL] = body.Text
+	}
+	return nil
+}
+
+// 記事タイトルの人名ごとに記事をまとめる
+// 人名のスコアには記事の重み(フィードの重み)を加え、
+// bodyWeightが正の場合は本文に出てくる人名も記事の重みのbodyWeight倍をスコアに加える
+func toContents(articles []cmd.NewsArticleJSON, bodies map[string]string, bodyWeight float64) []cmd.ContentItem {
 	mecab, err := mecab.New(map[string]string{"dicdir": ipadic})
 	if err != nil {
 		panic(err)
@@ -97,6 +125,7 @@ func toContents(articles []cmd.NewsArticleJSON) []cmd.ContentItem {
 
 	m := make(map[string]cmd.ContentItem)
 	for _, article := range articles {
+		weight := articleWeight(article)
 		title := strings.TrimSpace(strings.ToLower(article.Title))
 		i := strings.LastIndex(title, "(")
 		if i >= 0 {
@@ -124,35 +153,24 @@ func toContents(articles []cmd.NewsArticleJSON) []cmd.ContentItem {
 		}
 		title = strings.ReplaceAll(title, ":", "")
 		title = strings.ReplaceAll(title, "にも", "")
-		node, err := mecab.ParseToNode(title)
-		if err != nil {
-			panic(err)
-		}
-
-		for ; !node.IsZero(); node = node.Next() {
-			features := strings.Split(node.Feature(), ",")
-			if features[0] == "名詞" && features[1] == "固有名詞" && features[2] == "人名" && features[3] == "一般" {
-				// fmt.Println(node.String())
-				word := node.Surface()
-				if _, ok := excludeWord[word]; ok {
-					continue
-				}
-				contentItem, ok := m[word]
-				if !ok {
-					contentItem = cmd.ContentItem{
-						Word:  word,
-						Count: 0,
-					}
-					m[word] = contentItem
-				}
-				a := cmd.Article{
-					Title: article.Title,
-					URL:   article.URL,
-				}
-				contentItem.Articles = append(contentItem.Articles, a)
-				contentItem.Count = len(contentItem.Articles)
-				m[word] = contentItem
+
+		inTitle := make(map[string]bool)
+		for _, word := range personNames(mecab, title) {
+			inTitle[word] = true
+			addContentItem(m, word, article, weight)
+		}
+
+		// 本文の人名はタイトルに無いものだけを低い重みで加える
+		if bodyWeight <= 0 {
+			continue
+		}
+		inBody := make(map[string]bool)
+		for _, word := range personNames(mecab, strings.ToLower(bodies[article.URL])) {
+			if inTitle[word] || inBody[word] {
+				continue
 			}
+			inBody[word] = true
+			addContentItem(m, word, article, weight*bodyWeight)
 		}
 	}
 	var ret []cmd.ContentItem
@@ -160,10 +178,69 @@ func toContents(articles []cmd.NewsArticleJSON) []cmd.ContentItem {
 		// fmt.Println(fmt.Sprintf("\"%s\":            {},", key))
 		ret = append(ret, val)
 	}
-	sort.Slice(ret, func(i, j int) bool { return ret[i].Count > ret[j].Count })
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Score != ret[j].Score {
+			return ret[i].Score > ret[j].Score
+		}
+		return ret[i].Count > ret[j].Count
+	})
 	return ret[:100]
 }
 
+// 記事の重みを返す。重みを持たない記事(5chのスレッドなど)は1として扱う
+func articleWeight(article cmd.NewsArticleJSON) float64 {
+	if article.Weight <= 0 {
+		return 1
+	}
+	return article.Weight
+}
+
+// テキストに含まれる人名を出現順に返す
+func personNames(tagger mecab.MeCab, text string) []string {
+	if text == "" {
+		return nil
+	}
+	node, err := tagger.ParseToNode(text)
+	if err != nil {
+		panic(err)
+	}
+
+	var words []string
+	for ; !node.IsZero(); node = node.Next() {
+		features := strings.Split(node.Feature(), ",")
+		if len(features) < 4 {
+			continue
+		}
+		if features[0] == "名詞" && features[1] == "固有名詞" && features[2] == "人名" && features[3] == "一般" {
+			word := node.Surface()
+			if _, ok := excludeWord[word]; ok {
+				continue
+			}
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// 人名の記事一覧に記事を追加し、scoreをスコアに加える
+func addContentItem(m map[string]cmd.ContentItem, word string, article cmd.NewsArticleJSON, score float64) {
+	contentItem, ok := m[word]
+	if !ok {
+		contentItem = cmd.ContentItem{
+			Word:  word,
+			Count: 0,
+		}
+	}
+	a := cmd.Article{
+		Title: article.Title,
+		URL:   article.URL,
+	}
+	contentItem.Articles = append(contentItem.Articles, a)
+	contentItem.Count = len(contentItem.Articles)
+	contentItem.Score += score
+	m[word] = contentItem
+}
+
 var excludeWord = map[string]struct{}{
 	"web":     {},
 	"no":      {},
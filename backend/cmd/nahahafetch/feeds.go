@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/command"
+	"github.com/ohnishi/nahaha/backend/common/discover"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/ohnishi/nahaha/backend/common/opml"
+	"github.com/ohnishi/nahaha/backend/source"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// newFeedsCommand はフィード一覧を管理するサブコマンドを生成する
+func newFeedsCommand(config *fetch.Config) *cobra.Command {
+	var src string
+
+	c := &cobra.Command{
+		Use:   "feeds",
+		Short: "Manage feeds fetched by the rss command",
+	}
+	c.PersistentFlags().StringVar(&src, "src", "~/Desktop", "dir of the feed list file "+cmd.FeedListFileName)
+	c.AddCommand(
+		newFeedsListCommand(&src),
+		newFeedsAddCommand(&src),
+		newFeedsRemoveCommand(&src),
+		newFeedsImportCommand(&src),
+		newFeedsExportCommand(&src),
+		newFeedsDiscoverCommand(&src, config),
+	)
+	return c
+}
+
+func newFeedsListCommand(src *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List feeds",
+		Args:  cobra.NoArgs,
+		RunE: command.WithLoggingE(func(c *cobra.Command, args []string) error {
+			feeds, err := readFeedList(*src)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(c.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tCATEGORY\tWEIGHT\tLANGUAGE\tENABLED\tURL")
+			for _, f := range feeds {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%g\t%s\t%t\t%s\n", f.ID, f.Name, f.Category, f.Weight, f.Language, f.Enabled, f.URL)
+			}
+			return w.Flush()
+		}),
+	}
+}
+
+func newFeedsAddCommand(src *string) *cobra.Command {
+	var (
+		id       string
+		name     string
+		category string
+		weight   float64
+		language string
+		disabled bool
+	)
+
+	c := &cobra.Command{
+		Use:   "add <feed-url>",
+		Short: "Add a feed or replace the feed with the same ID or URL",
+		Args:  cobra.ExactArgs(1),
+		RunE: command.WithLoggingE(func(c *cobra.Command, args []string) error {
+			feed, err := newFeed(args[0], id, name)
+			if err != nil {
+				return err
+			}
+			feed.Category = category
+			feed.Weight = weight
+			feed.Language = language
+			feed.Enabled = !disabled
+			return updateFeedList(*src, func(feeds []cmd.Feed) ([]cmd.Feed, error) {
+				return cmd.UpsertFeeds(feeds, feed), nil
+			})
+		}),
+	}
+	c.Flags().StringVar(&id, "id", "", "feed ID used as the file name of fetched data (default generated from the URL)")
+	c.Flags().StringVar(&name, "name", "", "feed name (default the feed ID)")
+	c.Flags().StringVar(&category, "category", "", "feed category (e.g. entertainment, sports)")
+	c.Flags().Float64Var(&weight, "weight", 1, "weight of articles of the feed in analysis")
+	c.Flags().StringVar(&language, "language", "", "feed language (e.g. ja)")
+	c.Flags().BoolVar(&disabled, "disabled", false, "add the feed without fetching it")
+	return c
+}
+
+func newFeedsRemoveCommand(src *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <feed-id-or-url>...",
+		Short: "Remove feeds",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: command.WithLoggingE(func(c *cobra.Command, args []string) error {
+			return updateFeedList(*src, func(feeds []cmd.Feed) ([]cmd.Feed, error) {
+				ret, removed := cmd.RemoveFeeds(feeds, args...)
+				if removed == 0 {
+					return nil, errors.Errorf("feed not found: %v", args)
+				}
+				return ret, nil
+			})
+		}),
+	}
+}
+
+func newFeedsImportCommand(src *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "import <opml-file>",
+		Short: "Add feeds from an OPML file",
+		Args:  cobra.ExactArgs(1),
+		RunE: command.WithLoggingE(func(c *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return errors.Wrapf(err, "failed to open file: %s", args[0])
+			}
+			defer f.Close()
+
+			doc, err := opml.Parse(f)
+			if err != nil {
+				return err
+			}
+			return updateFeedList(*src, func(feeds []cmd.Feed) ([]cmd.Feed, error) {
+				// 登録済みのURLはfetch済みデータと対応させるため既存のIDを引き継ぐ
+				existing := make(map[string]cmd.Feed)
+				for _, f := range feeds {
+					existing[f.URL] = f
+				}
+				var adds []cmd.Feed
+				for _, o := range doc.Feeds() {
+					name := o.Title
+					if name == "" {
+						name = o.Text
+					}
+					old, ok := existing[o.XMLURL]
+					feed, err := newFeed(o.XMLURL, old.ID, name)
+					if err != nil {
+						return nil, err
+					}
+					feed.Category = o.Category
+					feed.Language = o.Language
+					if ok {
+						// OPMLで省略された重みと有効/無効、カテゴリと言語は登録済みの値を引き継ぐ
+						feed.Weight = old.Weight
+						feed.Enabled = old.Enabled
+						if feed.Category == "" {
+							feed.Category = old.Category
+						}
+						if feed.Language == "" {
+							feed.Language = old.Language
+						}
+					}
+					if o.Weight != "" {
+						if feed.Weight, err = strconv.ParseFloat(o.Weight, 64); err != nil {
+							return nil, errors.Errorf("invalid weight of %s : %q", o.XMLURL, o.Weight)
+						}
+					}
+					if o.Enabled != "" {
+						if feed.Enabled, err = strconv.ParseBool(o.Enabled); err != nil {
+							return nil, errors.Errorf("invalid enabled of %s : %q", o.XMLURL, o.Enabled)
+						}
+					}
+					adds = append(adds, feed)
+				}
+				return cmd.UpsertFeeds(feeds, adds...), nil
+			})
+		}),
+	}
+}
+
+func newFeedsExportCommand(src *string) *cobra.Command {
+	var out string
+
+	c := &cobra.Command{
+		Use:   "export",
+		Short: "Export feeds as OPML",
+		Args:  cobra.NoArgs,
+		RunE: command.WithLoggingE(func(c *cobra.Command, args []string) error {
+			feeds, err := readFeedList(*src)
+			if err != nil {
+				return err
+			}
+			doc := &opml.OPML{
+				Head: opml.Head{
+					Title:       "nahaha feeds",
+					DateCreated: time.Now().Format(time.RFC1123Z),
+				},
+			}
+			for _, f := range feeds {
+				doc.Body.Outlines = append(doc.Body.Outlines, opml.Outline{
+					Text:     f.Name,
+					Title:    f.Name,
+					Type:     "rss",
+					XMLURL:   f.URL,
+					Category: f.Category,
+					Language: f.Language,
+					Weight:   strconv.FormatFloat(f.Weight, 'g', -1, 64),
+					Enabled:  strconv.FormatBool(f.Enabled),
+				})
+			}
+
+			if out == "" {
+				return opml.Write(c.OutOrStdout(), doc)
+			}
+			f, err := cmd.CreateOutFile(out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := opml.Write(f, doc); err != nil {
+				return err
+			}
+			return f.Commit()
+		}),
+	}
+	c.Flags().StringVar(&out, "out", "", "OPML file to write (default stdout)")
+	return c
+}
+
+func newFeedsDiscoverCommand(src *string, config *fetch.Config) *cobra.Command {
+	var (
+		all      bool
+		dryRun   bool
+		category string
+		weight   float64
+		language string
+		disabled bool
+	)
+
+	c := &cobra.Command{
+		Use:   "discover <site-url>",
+		Short: "Find feeds linked from a site page and add valid ones",
+		Long: `Fetch the page and find RSS/Atom/JSON Feed links in <link rel="alternate">.
+Each feed is fetched and validated, and the first valid feed (or all with --all) is added.`,
+		Args: cobra.ExactArgs(1),
+		RunE: command.WithLoggingE(func(c *cobra.Command, args []string) error {
+			client := fetch.NewClient(*config)
+			found, err := discoverFeeds(c.Context(), client, args[0])
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(c.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "URL\tTYPE\tTITLE\tRESULT")
+			var adds []discoveredFeed
+			for _, f := range found {
+				result := "ok"
+				if f.err != nil {
+					result = f.err.Error()
+				} else if all || len(adds) == 0 {
+					adds = append(adds, f)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.link.URL, f.link.Type, f.title, result)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if len(adds) == 0 {
+				return errors.Errorf("no valid feed found: %s", args[0])
+			}
+			if dryRun {
+				return nil
+			}
+
+			return updateFeedList(*src, func(feeds []cmd.Feed) ([]cmd.Feed, error) {
+				// 登録済みのURLはfetch済みデータと対応させるため既存のIDを引き継ぐ
+				ids := make(map[string]string)
+				for _, f := range feeds {
+					ids[f.URL] = f.ID
+				}
+				var ret []cmd.Feed
+				for _, d := range adds {
+					feed, err := newFeed(d.link.URL, ids[d.link.URL], d.title)
+					if err != nil {
+						return nil, err
+					}
+					feed.Category = category
+					feed.Weight = weight
+					feed.Language = language
+					if feed.Language == "" {
+						feed.Language = d.language
+					}
+					feed.Enabled = !disabled
+					ret = append(ret, feed)
+					fmt.Fprintln(c.OutOrStdout(), "added", feed.ID, feed.URL)
+				}
+				return cmd.UpsertFeeds(feeds, ret...), nil
+			})
+		}),
+	}
+	c.Flags().BoolVar(&all, "all", false, "add all valid feeds instead of the first one")
+	c.Flags().BoolVar(&dryRun, "dry-run", false, "only print the discovered feeds")
+	c.Flags().StringVar(&category, "category", "", "feed category (e.g. entertainment, sports)")
+	c.Flags().Float64Var(&weight, "weight", 1, "weight of articles of the feed in analysis")
+	c.Flags().StringVar(&language, "language", "", "feed language (default the language declared in the feed)")
+	c.Flags().BoolVar(&disabled, "disabled", false, "add the feeds without fetching them")
+	return c
+}
+
+// discoveredFeed はautodiscoveryで見つけたフィードの検証結果を表す
+type discoveredFeed struct {
+	link     discover.FeedLink
+	title    string
+	language string
+	// err はフィードとして取得、パースできなかった場合のエラー
+	err error
+}
+
+// サイトのページを取得して<link rel="alternate">のフィードを探し、各フィードを取得してgofeedで検証する
+// ページ自体がフィードの場合はそのURLを返す
+func discoverFeeds(ctx context.Context, client *fetch.Client, siteURL string) ([]discoveredFeed, error) {
+	res, err := client.Get(ctx, siteURL)
+	if err != nil {
+		return nil, err
+	}
+	if feed, err := source.ParseFeed(res.Body); err == nil {
+		return []discoveredFeed{newDiscoveredFeed(discover.FeedLink{URL: res.URL, Type: feed.FeedType}, feed)}, nil
+	}
+
+	links, err := discover.FeedLinks(res.Body, res.Header.Get("Content-Type"), res.URL)
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, errors.Errorf("no feed link found: %s", siteURL)
+	}
+
+	var found []discoveredFeed
+	for _, l := range links {
+		res, err := client.Get(ctx, l.URL)
+		if err != nil {
+			found = append(found, discoveredFeed{link: l, title: l.Title, err: err})
+			continue
+		}
+		feed, err := source.ParseFeed(res.Body)
+		if err != nil {
+			found = append(found, discoveredFeed{link: l, title: l.Title, err: err})
+			continue
+		}
+		found = append(found, newDiscoveredFeed(l, feed))
+	}
+	return found, nil
+}
+
+// 検証できたフィードの情報を返す。名前はフィードのタイトル、無ければリンクのタイトルを使う
+func newDiscoveredFeed(l discover.FeedLink, feed *gofeed.Feed) discoveredFeed {
+	title := strings.TrimSpace(feed.Title)
+	if title == "" {
+		title = l.Title
+	}
+	return discoveredFeed{link: l, title: title, language: feed.Language}
+}
+
+// URLとIDと名前からフィードを生成する。IDと名前は省略できる
+func newFeed(url, id, name string) (cmd.Feed, error) {
+	if id == "" {
+		var err error
+		id, err = cmd.FeedIDFromURL(url)
+		if err != nil {
+			return cmd.Feed{}, err
+		}
+	} else if err := cmd.ValidateFeedID(id); err != nil {
+		return cmd.Feed{}, err
+	}
+	if name == "" {
+		name = id
+	}
+	return cmd.NewFeed(id, name, url), nil
+}
+
+// フィード一覧ファイルを読み込む。ファイルが存在しない場合は空の一覧を返す
+func readFeedList(dir string) ([]cmd.Feed, error) {
+	feeds, err := cmd.ReadFeeds(cmd.FeedListPath(dir))
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+	return feeds, nil
+}
+
+// フィード一覧ファイルをfnで更新して保存する
+func updateFeedList(dir string, fn func([]cmd.Feed) ([]cmd.Feed, error)) error {
+	feeds, err := readFeedList(dir)
+	if err != nil {
+		return err
+	}
+	feeds, err = fn(feeds)
+	if err != nil {
+		return err
+	}
+	return cmd.WriteFeeds(cmd.FeedListPath(dir), feeds)
+}
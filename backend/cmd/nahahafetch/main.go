@@ -1,83 +1,148 @@
 package main
 
 import (
+	"context"
+	"path/filepath"
+
+	"github.com/ohnishi/nahaha/backend/common/command"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/ohnishi/nahaha/backend/common/warc"
+	"github.com/ohnishi/nahaha/backend/source"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-func new5chFetchCommand() *cobra.Command {
-	var (
-		dest string
-	)
-
-	cmd := &cobra.Command{
-		Use:   "5ch",
-		Short: "Fetch 5ch thread",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			err := fetchNews5ch(dest, 3)
-			if err != nil {
-				return err
-			}
-			return nil
-		},
-	}
-	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "dir to save spotify json")
-
-	return cmd
+// fetchFlags はfetchサブコマンド共通のフラグの値を表す
+type fetchFlags struct {
+	src             string
+	dest            string
+	noCache         bool
+	noRaw           bool
+	gzip            bool
+	warcDir         string
+	warcMaxSize     int64
+	recordDir       string
+	replayDir       string
+	quarantineDir   string
+	healthThreshold float64
+	healthWindow    int
 }
 
-func newYahooFetchCommand() *cobra.Command {
-	var (
-		dest string
-	)
+// newFetchCommand は登録されたソースからfetchのサブコマンドを生成する
+func newFetchCommand(s source.Fetcher, config *fetch.Config) *cobra.Command {
+	var flags fetchFlags
 
 	cmd := &cobra.Command{
-		Use:   "yahoo",
-		Short: "Fetch yahoo thread",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			err := fetchYahooRSS(dest, 3)
-			if err != nil {
-				return err
-			}
-			return nil
-		},
+		Use:   s.Name(),
+		Short: "Fetch " + s.Description(),
+		RunE: command.WithLoggingE(func(cmd *cobra.Command, args []string) error {
+			return runFetch(cmd.Context(), s, *config, flags)
+		}),
+	}
+	cmd.PersistentFlags().StringVar(&flags.src, "src", "~/Desktop", "dir to read source settings from")
+	cmd.PersistentFlags().StringVar(&flags.dest, "dest", "~/Desktop", "dir to save fetched data")
+	setFetchFlags(cmd.PersistentFlags(), &flags)
+	if fs, ok := s.(source.FetchFlagSetter); ok {
+		fs.SetFetchFlags(cmd.Flags())
 	}
-	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "dir to save spotify json")
 
 	return cmd
 }
 
-func newRSSFetchCommand() *cobra.Command {
-	var (
-		src  string
-		dest string
-	)
+// setFetchFlags は--srcと--dest以外のfetch共通のフラグをセットアップする
+func setFetchFlags(f *pflag.FlagSet, flags *fetchFlags) {
+	f.BoolVar(&flags.noCache, "no-cache", false, "disable conditional GET with the ETag/Last-Modified cache in <dest>/.cache")
+	f.BoolVar(&flags.noRaw, "no-raw", false, "do not save response bodies as plain files (use with --warc-dir)")
+	f.BoolVar(&flags.gzip, "gzip", false, "save response bodies compressed with gzip (<name>.gz)")
+	f.StringVar(&flags.warcDir, "warc-dir", "", "dir to write WARC files of every HTTP exchange (disabled if empty)")
+	f.Int64Var(&flags.warcMaxSize, "warc-max-size", 1<<30, "size in bytes at which WARC files are rotated")
+	f.StringVar(&flags.recordDir, "record-dir", "", "dir to record every HTTP response for replaying later (disabled if empty)")
+	f.StringVar(&flags.replayDir, "replay-dir", "", "dir of HTTP responses recorded with --record-dir to replay instead of accessing the network")
+	f.StringVar(&flags.quarantineDir, "quarantine-dir", "", "dir to save response bodies rejected by validation (default <dest>/quarantine)")
+	f.Float64Var(&flags.healthThreshold, "health-threshold", 0.5, "fail if the number of boards, feeds or items falls below this ratio of the recent median in <dest>/health.jsonl (0 to only record)")
+	f.IntVar(&flags.healthWindow, "health-window", 7, "number of recent fetches whose median is the baseline of the health check")
+}
 
-	cmd := &cobra.Command{
-		Use:   "rss",
-		Short: "Fetch rss thread",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			err := fetchNewsRSS(src, dest, 3)
-			if err != nil {
-				return err
+// runFetch はフラグの設定に従ってクライアントを組み立て、ソースのfetchを実行する
+func runFetch(ctx context.Context, s source.Fetcher, config fetch.Config, flags fetchFlags) (err error) {
+	if flags.noRaw && flags.warcDir == "" {
+		return command.NewFlagErrorf("--no-raw requires --warc-dir")
+	}
+	if flags.recordDir != "" && flags.replayDir != "" {
+		return command.NewFlagErrorf("--record-dir and --replay-dir cannot be used together")
+	}
+	config.RecordDir = flags.recordDir
+	config.ReplayDir = flags.replayDir
+	if flags.replayDir != "" {
+		// リプレイ時はネットワークにアクセスしないのでrobots.txtもアクセス間隔も不要
+		config.RespectRobots = false
+		config.HostDelay = 0
+	}
+	// 記録とリプレイでは304ではなく実際のレスポンスを扱うためキャッシュを使わない
+	if !flags.noCache && flags.recordDir == "" && flags.replayDir == "" {
+		config.CacheDir = filepath.Join(flags.dest, ".cache")
+	}
+	client := fetch.NewClient(config)
+
+	if flags.warcDir != "" {
+		w := warc.NewWriter(flags.warcDir, s.Name(), flags.warcMaxSize)
+		defer func() {
+			if closeErr := w.Close(); err == nil {
+				err = closeErr
 			}
-			return nil
-		},
+		}()
+		client.AddRecorder(fetch.NewWARCRecorder(w))
 	}
-	cmd.PersistentFlags().StringVar(&src, "src", "~/Desktop", "dir to save spotify json")
-	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "dir to save spotify json")
 
-	return cmd
+	opts := source.FetchOptions{
+		Client:          client,
+		Src:             flags.src,
+		Dest:            flags.dest,
+		NoRaw:           flags.noRaw,
+		Gzip:            flags.gzip,
+		QuarantineDir:   flags.quarantineDir,
+		HealthThreshold: flags.healthThreshold,
+		HealthWindow:    flags.healthWindow,
+	}
+	if flags.replayDir != "" {
+		// 記録した日のスナップショットとして保存し、transformで記録した日のデータを再現できるようにする
+		t, err := fetch.RecordedAt(flags.replayDir)
+		if err != nil {
+			return errors.WithMessage(err, "failed to read the recording time")
+		}
+		opts.Time = t
+		opts.Replay = true
+	}
+	return s.Fetch(ctx, opts)
+}
+
+// setClientFlags はHTTPクライアントの設定フラグをセットアップする
+func setClientFlags(f *pflag.FlagSet, config *fetch.Config) {
+	f.DurationVar(&config.Timeout, "timeout", config.Timeout, "timeout of each HTTP request")
+	f.StringVar(&config.UserAgent, "user-agent", config.UserAgent, "User-Agent header sent with each HTTP request")
+	f.UintVar(&config.MaxRetry, "max-retry", config.MaxRetry, "max number of retries for each HTTP request")
+	f.DurationVar(&config.MinBackoff, "min-backoff", config.MinBackoff, "initial wait before retrying a failed HTTP request")
+	f.DurationVar(&config.MaxBackoff, "max-backoff", config.MaxBackoff, "max wait before retrying a failed HTTP request")
+	f.BoolVar(&config.RespectRobots, "respect-robots", config.RespectRobots, "skip URLs disallowed by robots.txt and honor its Crawl-delay")
+	f.DurationVar(&config.HostDelay, "host-delay", config.HostDelay, "min interval between HTTP requests to the same host")
 }
 
 func main() {
+	ctx, cancel := command.SignalContext(context.Background())
+	defer cancel()
+
+	config := fetch.DefaultConfig()
+
 	rootCmd := &cobra.Command{Use: "nahahafetch"}
-	rootCmd.AddCommand(
-		new5chFetchCommand(),
-		newYahooFetchCommand(),
-		newRSSFetchCommand(),
-	)
+	setClientFlags(rootCmd.PersistentFlags(), &config)
+	for _, s := range source.Fetchers() {
+		rootCmd.AddCommand(newFetchCommand(s, &config))
+	}
+	rootCmd.AddCommand(newFeedsCommand(&config))
+	rootCmd.AddCommand(newServeCommand(&config))
 
-	err := rootCmd.Execute()
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/common/command"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/ohnishi/nahaha/backend/source"
+	"github.com/spf13/cobra"
+)
+
+// schedule はソースをfetchする間隔を表す
+type schedule struct {
+	source   source.Fetcher
+	interval time.Duration
+	// dir はソースの設定を読み込み、fetchしたデータを保存するディレクトリ
+	dir string
+}
+
+// newServeCommand は複数のソースを一定間隔でfetchし続けるサブコマンドを生成する。
+// ソース固有のフラグは各fetchサブコマンドで設定したデフォルト値を使う。
+func newServeCommand(config *fetch.Config) *cobra.Command {
+	var (
+		flags     fetchFlags
+		intervals map[string]string
+		dirs      map[string]string
+		jitter    time.Duration
+	)
+
+	c := &cobra.Command{
+		Use:   "serve",
+		Short: "Fetch sources periodically until SIGINT/SIGTERM (send it again to exit immediately)",
+		Args:  cobra.NoArgs,
+		RunE: command.WithLoggingE(func(c *cobra.Command, args []string) error {
+			schedules, err := toSchedules(intervals, dirs, flags.dest)
+			if err != nil {
+				return err
+			}
+			if jitter < 0 {
+				return command.NewFlagErrorf("invalid jitter: %s", jitter)
+			}
+			return serve(c.Context(), schedules, *config, flags, jitter)
+		}),
+	}
+	c.Flags().StringVar(&flags.dest, "dest", "~/Desktop", "root dir of the dirs of each source")
+	setFetchFlags(c.Flags(), &flags)
+	c.Flags().StringToStringVar(&dirs, "dir", map[string]string{"yahoo": "rss"}, "dir of each source relative to --dest in 'source=dir' (source name if not specified)")
+	c.Flags().StringToStringVar(&intervals, "interval", map[string]string{"5ch": "10m", "yahoo": "24h", "rss": "15m"}, "fetch interval of each source in 'source=duration'")
+	c.Flags().DurationVar(&jitter, "jitter", time.Minute, "max random delay added to each interval to spread fetches")
+
+	return c
+}
+
+// --intervalと--dirの値をソースごとのスケジュールに変換してソース名順に返す
+// yahooが保存するフィード一覧をrssが読み込むように、ソースはディレクトリを共有できる
+func toSchedules(intervals, dirs map[string]string, root string) ([]schedule, error) {
+	names := make([]string, 0, len(intervals))
+	for name := range intervals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var schedules []schedule
+	for _, name := range names {
+		s, ok := source.Lookup(name)
+		if !ok {
+			return nil, command.NewFlagErrorf("unknown source: %s", name)
+		}
+		f, ok := s.(source.Fetcher)
+		if !ok {
+			return nil, command.NewFlagErrorf("source cannot be fetched: %s", name)
+		}
+		d, err := time.ParseDuration(intervals[name])
+		if err != nil || d <= 0 {
+			return nil, command.NewFlagErrorf("invalid interval of %s: %s", name, intervals[name])
+		}
+		dir, ok := dirs[name]
+		if !ok {
+			dir = name
+		}
+		schedules = append(schedules, schedule{source: f, interval: d, dir: filepath.Join(root, dir)})
+	}
+	if len(schedules) == 0 {
+		return nil, command.NewFlagErrorf("no source to fetch")
+	}
+	return schedules, nil
+}
+
+// serve はスケジュールに従ってソースごとにfetchを繰り返す。
+// 同じソースのfetchは前回のfetchが終わってから次の間隔を待つので重ならない。
+// ctxがキャンセルされる(SIGINT/SIGTERMを受け取る)と新しいfetchを開始せず、実行中のfetchが終わるのを待って返す。
+// 実行中のfetchはctxでキャンセルしないので、書き込み途中のデータは最後まで書き込まれる。
+// 待っている間にもう一度シグナルを受け取ると実行中のfetchもキャンセルする。
+func serve(ctx context.Context, schedules []schedule, config fetch.Config, flags fetchFlags, jitter time.Duration) error {
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 1回目のシグナルはSignalContextがctxのキャンセルとして受け取る。
+	// 同じシグナルがこのチャネルにも届くので、2回目を受け取ったら実行中のfetchをキャンセルする
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		for i := 0; i < 2; i++ {
+			select {
+			case <-sig:
+			case <-runCtx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomDelay := func() time.Duration {
+		if jitter <= 0 {
+			return 0
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return time.Duration(r.Int63n(int64(jitter) + 1))
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range schedules {
+		wg.Add(1)
+		go func(s schedule) {
+			defer wg.Done()
+			// 起動直後に全ソースのfetchが重ならないように最初もずらす
+			wait := randomDelay()
+			for {
+				if !sleepContext(ctx, wait) {
+					return
+				}
+				runScheduled(runCtx, s, config, flags)
+				wait = s.interval + randomDelay()
+			}
+		}(s)
+	}
+	wg.Wait()
+	fmt.Println("serve stopped.")
+	return nil
+}
+
+// スケジュールされたfetchを1回実行する。失敗しても次のfetchは続ける。
+func runScheduled(ctx context.Context, s schedule, config fetch.Config, flags fetchFlags) {
+	name := s.source.Name()
+	flags.src = s.dir
+	flags.dest = s.dir
+	if flags.quarantineDir != "" {
+		// ソースごとのデータは同じ相対パスになりうるので隔離ディレクトリもソースごとに分ける
+		flags.quarantineDir = filepath.Join(flags.quarantineDir, name)
+	}
+	// 取得結果はマニフェストに記録されるので、serveを止めずに続けるfetch自体の失敗だけを出力する
+	if err := runFetch(ctx, s.source, config, flags); err != nil {
+		fmt.Printf("fetch failed. source=%s error=%v\n", name, err)
+	}
+}
+
+// dだけ待ってtrueを返す。待っている間にctxがキャンセルされた場合はfalseを返す
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
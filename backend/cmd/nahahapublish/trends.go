@@ -52,10 +52,7 @@ func writeContent(dest string, date time.Time, content cmd.Content) error {
 		log.Fatal(err)
 	}
 
-	if err := f.Sync(); err != nil {
-		return errors.Wrap(err, "failed to sync file")
-	}
-	return nil
+	return f.Commit()
 }
 
 const tmplStr = `
@@ -69,6 +66,12 @@ sidebar: "right"
 ### {{ rank $i }}位 {{ $item.Word }} （{{ $item.Count }}記事）
 {{ range $j, $article := $item.Articles -}}
 - [{{ $article.Title }}]({{ $article.URL }})
+{{- if $article.Image }}
+  ![{{ $article.Title }}]({{ $article.Image }})
+{{- end }}
+{{- if $article.Description }}
+  > {{ $article.Description }}
+{{- end }}
 {{ end }}
 {{ end }}
 `
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"time"
 
 	"github.com/ohnishi/nahaha/backend/common/command"
+	"github.com/ohnishi/nahaha/backend/source"
 	"github.com/spf13/cobra"
 )
 
-func transformRSSCommand() *cobra.Command {
+// newTransformCommand は登録されたソースからtransformのサブコマンドを生成する
+func newTransformCommand(s source.Transformer) *cobra.Command {
 	var (
 		src   string
 		dest  string
@@ -15,45 +18,16 @@ func transformRSSCommand() *cobra.Command {
 	)
 
 	cmd := &cobra.Command{
-		Use:   "rss",
-		Short: "Transform rss thread",
+		Use:   s.Name(),
+		Short: "Transform " + s.Description(),
 		RunE: command.WithLoggingE(func(cmd *cobra.Command, args []string) error {
-			return command.EachDate(dates, func(date time.Time) error {
-				return transformRSS(src, dest, date)
+			return command.EachDateContext(cmd.Context(), dates, func(date time.Time) error {
+				return s.Transform(cmd.Context(), src, dest, date)
 			})
 		}),
-		// RunE: func(cmd *cobra.Command, args []string) error {
-		// 	return command.EachDate(dates, func(date time.Time) error {
-		// 		return transformNews5ch(src, dest, date)
-		// 	})
-		// },
 	}
-	cmd.PersistentFlags().StringVar(&src, "src", "~/Desktop", "dir to save spotify json")
-	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "dir to save spotify json")
-	command.SetDatesFlag(cmd.Flags(), &dates, "date for which the URL list file(s) is generated")
-	_ = cmd.MarkFlagRequired("date")
-
-	return cmd
-}
-
-func transform5chCommand() *cobra.Command {
-	var (
-		src   string
-		dest  string
-		dates []string
-	)
-
-	cmd := &cobra.Command{
-		Use:   "5ch",
-		Short: "Transform 5ch thread",
-		RunE: command.WithLoggingE(func(cmd *cobra.Command, args []string) error {
-			return command.EachDate(dates, func(date time.Time) error {
-				return transform5ch(src, dest, date)
-			})
-		}),
-	}
-	cmd.PersistentFlags().StringVar(&src, "src", "~/Desktop", "dir to save spotify json")
-	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "dir to save spotify json")
+	cmd.PersistentFlags().StringVar(&src, "src", "~/Desktop", "dir to read fetched data from")
+	cmd.PersistentFlags().StringVar(&dest, "dest", "~/Desktop", "dir to save transformed articles")
 	command.SetDatesFlag(cmd.Flags(), &dates, "date for which the URL list file(s) is generated")
 	_ = cmd.MarkFlagRequired("date")
 
@@ -61,13 +35,15 @@ func transform5chCommand() *cobra.Command {
 }
 
 func main() {
+	ctx, cancel := command.SignalContext(context.Background())
+	defer cancel()
+
 	rootCmd := &cobra.Command{Use: "nahahatransform"}
-	rootCmd.AddCommand(
-		transformRSSCommand(),
-		transform5chCommand(),
-	)
+	for _, s := range source.Transformers() {
+		rootCmd.AddCommand(newTransformCommand(s))
+	}
 
-	err := rootCmd.Execute()
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		panic(err)
 	}
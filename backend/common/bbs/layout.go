@@ -0,0 +1,125 @@
+package bbs
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Layout は掲示板サイトの板URLとsubject.txt、スレッドURLの構成を表す
+type Layout interface {
+	// BoardID は板URLから板IDを返す
+	BoardID(boardURL string) (string, error)
+	// SubjectURL は板URLからsubject.txtのURLを返す
+	SubjectURL(boardURL string) (string, error)
+	// ThreadURL は板URLとスレッドキーからスレッドURLを返す
+	ThreadURL(boardURL, key string) (string, error)
+}
+
+// Nichannel は5ch、open2ch、bbspinkなど2ちゃんねる互換の掲示板のLayout。
+// 板URLは https://<host>/<板ID>/、スレッドURLは https://<host>/test/read.cgi/<板ID>/<スレッドキー>/ になる
+var Nichannel Layout = nichannelLayout{}
+
+type nichannelLayout struct{}
+
+func (nichannelLayout) BoardID(boardURL string) (string, error) {
+	_, segments, err := splitBoardURL(boardURL)
+	if err != nil {
+		return "", err
+	}
+	if len(segments) != 1 {
+		return "", errors.Errorf("illegal board URL : %s", boardURL)
+	}
+	return segments[0], nil
+}
+
+func (l nichannelLayout) SubjectURL(boardURL string) (string, error) {
+	u, _, err := splitBoardURL(boardURL)
+	if err != nil {
+		return "", err
+	}
+	id, err := l.BoardID(boardURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = fmt.Sprintf("/%s/subject.txt", id)
+	return u.String(), nil
+}
+
+func (l nichannelLayout) ThreadURL(boardURL, key string) (string, error) {
+	u, _, err := splitBoardURL(boardURL)
+	if err != nil {
+		return "", err
+	}
+	id, err := l.BoardID(boardURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = fmt.Sprintf("/test/read.cgi/%s/%s/", id, key)
+	return u.String(), nil
+}
+
+// Shitaraba はしたらば掲示板のLayout。
+// 板URLは https://jbbs.shitaraba.net/<カテゴリ>/<板番号>/、
+// スレッドURLは https://jbbs.shitaraba.net/bbs/read.cgi/<カテゴリ>/<板番号>/<スレッドキー>/ になる。
+// 板IDは <カテゴリ>/<板番号> とする
+var Shitaraba Layout = shitarabaLayout{}
+
+type shitarabaLayout struct{}
+
+func (shitarabaLayout) BoardID(boardURL string) (string, error) {
+	_, segments, err := splitBoardURL(boardURL)
+	if err != nil {
+		return "", err
+	}
+	if len(segments) != 2 {
+		return "", errors.Errorf("illegal board URL : %s", boardURL)
+	}
+	return segments[0] + "/" + segments[1], nil
+}
+
+func (l shitarabaLayout) SubjectURL(boardURL string) (string, error) {
+	u, _, err := splitBoardURL(boardURL)
+	if err != nil {
+		return "", err
+	}
+	id, err := l.BoardID(boardURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = fmt.Sprintf("/%s/subject.txt", id)
+	return u.String(), nil
+}
+
+func (l shitarabaLayout) ThreadURL(boardURL, key string) (string, error) {
+	u, _, err := splitBoardURL(boardURL)
+	if err != nil {
+		return "", err
+	}
+	id, err := l.BoardID(boardURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = fmt.Sprintf("/bbs/read.cgi/%s/%s/", id, key)
+	return u.String(), nil
+}
+
+// 板URLをパースしてパスの要素とともに返す
+func splitBoardURL(boardURL string) (*url.URL, []string, error) {
+	u, err := url.Parse(boardURL)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed parse url : %s", boardURL)
+	}
+	if u.Host == "" {
+		return nil, nil, errors.Errorf("illegal board URL : %s", boardURL)
+	}
+	p := strings.Trim(u.Path, "/")
+	if p == "" {
+		return nil, nil, errors.Errorf("illegal board URL : %s", boardURL)
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u, strings.Split(p, "/"), nil
+}
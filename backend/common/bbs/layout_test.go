@@ -0,0 +1,84 @@
+package bbs_test
+
+import (
+	"testing"
+
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+)
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		name       string
+		layout     bbs.Layout
+		boardURL   string
+		boardID    string
+		subjectURL string
+		threadURL  string
+		wantErr    bool
+	}{
+		{
+			name:       "5ch",
+			layout:     bbs.Nichannel,
+			boardURL:   "https://hayabusa9.5ch.net/news/",
+			boardID:    "news",
+			subjectURL: "https://hayabusa9.5ch.net/news/subject.txt",
+			threadURL:  "https://hayabusa9.5ch.net/test/read.cgi/news/1604124000/",
+		},
+		{
+			name:       "5ch without trailing slash and with query",
+			layout:     bbs.Nichannel,
+			boardURL:   "https://hayabusa9.5ch.net/news?x=1#top",
+			boardID:    "news",
+			subjectURL: "https://hayabusa9.5ch.net/news/subject.txt",
+			threadURL:  "https://hayabusa9.5ch.net/test/read.cgi/news/1604124000/",
+		},
+		{
+			name:       "open2ch",
+			layout:     bbs.Nichannel,
+			boardURL:   "https://hayabusa.open2ch.net/livejupiter/",
+			boardID:    "livejupiter",
+			subjectURL: "https://hayabusa.open2ch.net/livejupiter/subject.txt",
+			threadURL:  "https://hayabusa.open2ch.net/test/read.cgi/livejupiter/1604124000/",
+		},
+		{
+			name:       "shitaraba",
+			layout:     bbs.Shitaraba,
+			boardURL:   "https://jbbs.shitaraba.net/internet/12345/",
+			boardID:    "internet/12345",
+			subjectURL: "https://jbbs.shitaraba.net/internet/12345/subject.txt",
+			threadURL:  "https://jbbs.shitaraba.net/bbs/read.cgi/internet/12345/1604124000/",
+		},
+		{name: "5ch with nested path", layout: bbs.Nichannel, boardURL: "https://hayabusa9.5ch.net/test/read.cgi/", wantErr: true},
+		{name: "5ch top page", layout: bbs.Nichannel, boardURL: "https://www.5ch.net/", wantErr: true},
+		{name: "relative URL", layout: bbs.Nichannel, boardURL: "/news/", wantErr: true},
+		{name: "shitaraba without board number", layout: bbs.Shitaraba, boardURL: "https://jbbs.shitaraba.net/internet/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			boardID, err := tt.layout.BoardID(tt.boardURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BoardID(%q) error = %v, wantErr %v", tt.boardURL, err, tt.wantErr)
+			}
+			subjectURL, err := tt.layout.SubjectURL(tt.boardURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SubjectURL(%q) error = %v, wantErr %v", tt.boardURL, err, tt.wantErr)
+			}
+			threadURL, err := tt.layout.ThreadURL(tt.boardURL, "1604124000")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ThreadURL(%q) error = %v, wantErr %v", tt.boardURL, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if boardID != tt.boardID {
+				t.Errorf("BoardID(%q) = %q, want %q", tt.boardURL, boardID, tt.boardID)
+			}
+			if subjectURL != tt.subjectURL {
+				t.Errorf("SubjectURL(%q) = %q, want %q", tt.boardURL, subjectURL, tt.subjectURL)
+			}
+			if threadURL != tt.threadURL {
+				t.Errorf("ThreadURL(%q) = %q, want %q", tt.boardURL, threadURL, tt.threadURL)
+			}
+		})
+	}
+}
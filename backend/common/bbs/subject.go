@@ -0,0 +1,118 @@
+package bbs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// Thread はsubject.txtの1行が表すスレッドを表す
+type Thread struct {
+	// Key はスレッドキー。スレッド作成時刻のUnix時間になっている
+	Key string
+	// Title はスレッドタイトル。末尾のレス数は含まない
+	Title string
+	// ResCount はレス数。パースできない場合は0
+	ResCount int
+	// CreatedAt はスレッドキーから求めたスレッド作成時刻
+	CreatedAt time.Time
+}
+
+var (
+	// subject.txtの行 <スレッドキー>.dat<>タイトル (レス数) または <スレッドキー>.cgi,タイトル(レス数)
+	subjectLine = regexp.MustCompile(`^(\d+)\.(?:dat|cgi)(?:<>|,)(.*)$`)
+	// タイトル末尾のレス数
+	resCount = regexp.MustCompile(`\s*\((\d+)\)\s*$`)
+)
+
+// ParseSubjectLine はデコード済みのsubject.txtの1行をパースしてスレッドを返す
+func ParseSubjectLine(line string) (Thread, error) {
+	var t Thread
+	m := subjectLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+	if m == nil {
+		return t, errors.Errorf("unexpected subject.txt line: %s", line)
+	}
+	sec, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return t, errors.Wrapf(err, "unexpected thread key: %s", m[1])
+	}
+	t.Key = m[1]
+	t.CreatedAt = time.Unix(sec, 0)
+
+	title := m[2]
+	if rc := resCount.FindStringSubmatchIndex(title); rc != nil {
+		// レス数はタイトル末尾の数字のみなのでパースに失敗することはない
+		t.ResCount, _ = strconv.Atoi(title[rc[2]:rc[3]])
+		title = title[:rc[0]]
+	}
+	t.Title = strings.TrimSpace(title)
+	return t, nil
+}
+
+// ReadSubject はencで符号化されたsubject.txtを1行ずつパースしてfnに渡す。
+// パースできない行はerrを付けて渡し、読み込みを続ける。encがnilの場合はUTF-8として読み込む。
+func ReadSubject(r io.Reader, enc encoding.Encoding, fn func(line string, t Thread, err error)) error {
+	if enc != nil {
+		r = transform.NewReader(r, enc.NewDecoder())
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		t, err := ParseSubjectLine(line)
+		fn(line, t, err)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read subject.txt")
+	}
+	return nil
+}
+
+// ValidateSubject はbodyがsubject.txtの形式でないか、スレッドの行が無ければエラーを返す。
+// 移転案内やエラーページなどのHTMLをsubject.txtとして保存しないために使う。
+func ValidateSubject(body []byte) error {
+	if LooksLikeHTML(body) {
+		return errors.New("unexpected HTML instead of subject.txt")
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		// 先頭の行が形式どおりならsubject.txtとみなす。タイトルの文字コードはここでは問わない
+		if !subjectLine.Match(bytes.TrimRight(line, "\r")) {
+			return errors.Errorf("unexpected subject.txt line %q", truncate(line, 64))
+		}
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "failed to read subject.txt")
+	}
+	// 空白だけのボディは空のレスポンスとして扱う
+	return errors.New("no thread in subject.txt")
+}
+
+// LooksLikeHTML はbodyがHTMLならtrueを返す
+func LooksLikeHTML(body []byte) bool {
+	head := bytes.ToLower(truncate(bytes.TrimSpace(body), 512))
+	return bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.Contains(head, []byte("<html"))
+}
+
+// bの先頭n byteを返す
+func truncate(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[:n]
+	}
+	return b
+}
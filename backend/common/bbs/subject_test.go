@@ -0,0 +1,83 @@
+package bbs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+)
+
+func TestParseSubjectLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    bbs.Thread
+		wantErr bool
+	}{
+		{
+			name: "5ch",
+			line: "1604124000.dat<>【速報】テスト (123)",
+			want: bbs.Thread{Key: "1604124000", Title: "【速報】テスト", ResCount: 123, CreatedAt: time.Unix(1604124000, 0)},
+		},
+		{
+			name: "shitaraba",
+			line: "1604124000.cgi,テスト(45)",
+			want: bbs.Thread{Key: "1604124000", Title: "テスト", ResCount: 45, CreatedAt: time.Unix(1604124000, 0)},
+		},
+		{
+			name: "CRLF",
+			line: "1604124000.dat<>テスト (1)\r",
+			want: bbs.Thread{Key: "1604124000", Title: "テスト", ResCount: 1, CreatedAt: time.Unix(1604124000, 0)},
+		},
+		{
+			name: "only the last parenthesized number is the response count",
+			line: "1604124000.dat<>テスト(2020) (7)",
+			want: bbs.Thread{Key: "1604124000", Title: "テスト(2020)", ResCount: 7, CreatedAt: time.Unix(1604124000, 0)},
+		},
+		{
+			name: "without response count",
+			line: "1604124000.dat<>テスト",
+			want: bbs.Thread{Key: "1604124000", Title: "テスト", CreatedAt: time.Unix(1604124000, 0)},
+		},
+		{name: "HTML", line: "<html><body>移転しました</body></html>", wantErr: true},
+		{name: "no extension", line: "1604124000<>テスト (1)", wantErr: true},
+		{name: "non-numeric key", line: "abc.dat<>テスト (1)", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bbs.ParseSubjectLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSubjectLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Key != tt.want.Key || got.Title != tt.want.Title || got.ResCount != tt.want.ResCount || !got.CreatedAt.Equal(tt.want.CreatedAt) {
+				t.Errorf("ParseSubjectLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{name: "5ch", body: "1604124000.dat<>テスト (1)\n1604124001.dat<>テスト2 (2)\n"},
+		{name: "leading blank lines", body: "\n\r\n1604124000.cgi,テスト(1)\n"},
+		{name: "empty", body: "", wantErr: true},
+		{name: "whitespace only", body: " \n\r\n\t\n", wantErr: true},
+		{name: "HTML", body: "<!DOCTYPE html><html><head><title>移転</title></head></html>", wantErr: true},
+		{name: "error message", body: "ERROR: board not found\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := bbs.ValidateSubject([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSubject(%q) error = %v, wantErr %v", tt.body, err, tt.wantErr)
+			}
+		})
+	}
+}
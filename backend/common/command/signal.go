@@ -0,0 +1,39 @@
+package command
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SignalContext はSIGINTかSIGTERMを受け取るとキャンセルされるcontextを返す。
+// キャンセル後のシグナルはデフォルトの動作に戻すので、もう一度送るとプロセスを強制終了できる。
+func SignalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sig)
+	}()
+	return ctx, cancel
+}
+
+// EachDateContext はEachDateと同様に日付ごとに引数fnを実行する。
+// ctxがキャンセルされた場合は残りの日付を実行せずにエラーを返す。
+func EachDateContext(ctx context.Context, date []string, fn func(time.Time) error) error {
+	return EachDate(date, func(t time.Time) error {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrapf(err, "canceled before %s", t.Format(DatesFlagFormat))
+		}
+		return fn(t)
+	})
+}
@@ -0,0 +1,93 @@
+package discover
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/charset"
+)
+
+// feedTypes はフィードとみなす<link rel="alternate">のtype属性
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+	"application/json":      true,
+	"application/rdf+xml":   true,
+	"application/xml":       true,
+	"text/xml":              true,
+}
+
+// FeedLink はページの<link rel="alternate">で示されたフィードを表す
+type FeedLink struct {
+	// URL はページのURLを基準に解決したフィードのURL
+	URL string
+	// Title はlink要素のtitle属性
+	Title string
+	// Type はlink要素のtype属性
+	Type string
+}
+
+// FeedLinks はHTMLのページから<link rel="alternate">のRSS/Atom/JSON Feedのリンクを探して、ページ内の順序で返す。
+// 文字コードはContent-TypeとHTMLのmetaから判定し、相対URLは<base>かpageURLを基準に解決する。
+func FeedLinks(b []byte, contentType, pageURL string) ([]FeedLink, error) {
+	r, err := charset.NewReader(bytes.NewReader(b), contentType)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to detect charset: %s", pageURL)
+	}
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parse response body : %s", pageURL)
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parse url : %s", pageURL)
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+			base = u
+		}
+	}
+
+	var links []FeedLink
+	seen := make(map[string]bool)
+	doc.Find("link[rel][href]").Each(func(_ int, s *goquery.Selection) {
+		rel, _ := s.Attr("rel")
+		if !hasToken(rel, "alternate") {
+			return
+		}
+		typ, _ := s.Attr("type")
+		typ = strings.ToLower(strings.TrimSpace(strings.SplitN(typ, ";", 2)[0]))
+		if !feedTypes[typ] {
+			return
+		}
+		href, _ := s.Attr("href")
+		u, err := base.Parse(strings.TrimSpace(href))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment = ""
+		if seen[u.String()] {
+			return
+		}
+		seen[u.String()] = true
+
+		title, _ := s.Attr("title")
+		links = append(links, FeedLink{URL: u.String(), Title: strings.TrimSpace(title), Type: typ})
+	})
+	return links, nil
+}
+
+// 空白区切りの属性値にtokenが含まれていればtrueを返す
+func hasToken(attr, token string) bool {
+	for _, t := range strings.Fields(attr) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
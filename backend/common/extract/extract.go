@@ -0,0 +1,156 @@
+package extract
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// 本文ではないことが明らかな要素
+const removeSelector = "script, style, noscript, iframe, nav, header, footer, aside, form, button, svg, figure"
+
+var (
+	// class/idに含まれていれば本文ではない可能性が高い名前
+	negativeNames = regexp.MustCompile(`(?i)comment|footer|sidebar|side|menu|nav|banner|share|social|sns|related|ranking|recommend|breadcrumb|popup|pickup|promo|sponsor|\bads?\b|ad-`)
+	// class/idに含まれていれば本文の可能性が高い名前
+	positiveNames = regexp.MustCompile(`(?i)article|body|content|main|text|entry|story|post|honbun|news`)
+)
+
+// 本文の段落とみなす最小文字数
+const minParagraphLen = 25
+
+// MainText は記事ページのHTMLから本文のテキストを抽出する。
+// 文字コードはContent-TypeとHTMLのmetaから判定する。本文が見つからない場合は空文字を返す。
+func MainText(b []byte, contentType string) (string, error) {
+	r, err := charset.NewReader(bytes.NewReader(b), contentType)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to detect charset")
+	}
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse html")
+	}
+	return MainTextFromDocument(doc), nil
+}
+
+// MainTextFromDocument はdocから本文のテキストを抽出する。docの要素は変更される。
+// readabilityと同様に、段落の文字数と読点の数を親要素のスコアとして加算し、
+// リンク密度とclass/idの名前で補正したスコアが最も高い要素を本文とする。
+func MainTextFromDocument(doc *goquery.Document) string {
+	doc.Find(removeSelector).Remove()
+	doc.Find("[class], [id]").Each(func(_ int, s *goquery.Selection) {
+		if goquery.NodeName(s) == "body" || goquery.NodeName(s) == "article" {
+			return
+		}
+		names := classAndID(s)
+		if negativeNames.MatchString(names) && !positiveNames.MatchString(names) {
+			s.Remove()
+		}
+	})
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*goquery.Selection
+	addScore := func(s *goquery.Selection, score float64) {
+		if s.Length() == 0 {
+			return
+		}
+		n := s.Get(0)
+		if _, ok := scores[n]; !ok {
+			candidates = append(candidates, s)
+			scores[n] = nameWeight(s)
+		}
+		scores[n] += score
+	}
+	doc.Find("p, pre, td").Each(func(_ int, p *goquery.Selection) {
+		text := strings.TrimSpace(p.Text())
+		length := utf8.RuneCountInString(text)
+		if length < minParagraphLen {
+			return
+		}
+		score := 1 + float64(strings.Count(text, "、")+strings.Count(text, ",")+strings.Count(text, "，"))
+		score += math.Min(float64(length)/100, 3)
+
+		addScore(p.Parent(), score)
+		addScore(p.Parent().Parent(), score/2)
+	})
+
+	var best *goquery.Selection
+	bestScore := 0.0
+	for _, c := range candidates {
+		score := scores[c.Get(0)] * (1 - linkDensity(c))
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	if best == nil {
+		// 段落が無いページは本文らしい要素のテキストをそのまま使う
+		best = doc.Find("article, main, body").First()
+	}
+	return paragraphs(best)
+}
+
+// 要素のclassとidを連結して返す
+func classAndID(s *goquery.Selection) string {
+	class, _ := s.Attr("class")
+	id, _ := s.Attr("id")
+	return class + " " + id
+}
+
+// class/idの名前による補正値を返す
+func nameWeight(s *goquery.Selection) float64 {
+	names := classAndID(s)
+	weight := 0.0
+	if negativeNames.MatchString(names) {
+		weight -= 25
+	}
+	if positiveNames.MatchString(names) {
+		weight += 25
+	}
+	switch goquery.NodeName(s) {
+	case "article", "main":
+		weight += 10
+	}
+	return weight
+}
+
+// 要素のテキストのうちリンクのテキストが占める割合を返す
+func linkDensity(s *goquery.Selection) float64 {
+	length := utf8.RuneCountInString(s.Text())
+	if length == 0 {
+		return 0
+	}
+	links := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		links += utf8.RuneCountInString(a.Text())
+	})
+	return float64(links) / float64(length)
+}
+
+// 要素の段落ごとのテキストを改行で連結して返す。段落が無い場合は要素のテキストを返す
+func paragraphs(s *goquery.Selection) string {
+	var lines []string
+	s.Find("p, pre, h1, h2, h3, li").Each(func(_ int, p *goquery.Selection) {
+		if p.ParentsFiltered("p, pre, li").Length() > 0 {
+			return
+		}
+		if text := normalizeSpace(p.Text()); text != "" {
+			lines = append(lines, text)
+		}
+	})
+	if len(lines) == 0 {
+		return normalizeSpace(s.Text())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 連続する空白を1つにまとめる
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
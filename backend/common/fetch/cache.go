@@ -0,0 +1,102 @@
+package fetch
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/pkg/errors"
+)
+
+// cache はURLごとのETag/Last-Modifiedとレスポンスボディをディレクトリに永続化する
+type cache struct {
+	dir string
+}
+
+// cacheEntry はキャッシュしたレスポンスのメタデータ
+type cacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	FetchedAt    string `json:"fetched_at"`
+}
+
+// setConditionalHeaders はキャッシュがあればreqに条件付きGETのヘッダーを付与する
+func (c *cache) setConditionalHeaders(req *http.Request) {
+	url := req.URL.String()
+	e, ok := c.entry(url)
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(c.path(url, ".body")); err != nil {
+		// ボディが無ければ304を受け取っても再利用できないので条件なしで取得する
+		return
+	}
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+// body はurlに対してキャッシュしているレスポンスボディを返す
+func (c *cache) body(url string) ([]byte, error) {
+	path := c.path(url, ".body")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read cached body: %s", path)
+	}
+	return b, nil
+}
+
+// store はレスポンスがETagかLast-Modifiedを持っていればキャッシュに保存する
+func (c *cache) store(url string, res *Response) error {
+	e := cacheEntry{
+		URL:          url,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now().Format(time.RFC3339),
+	}
+	if e.ETag == "" && e.LastModified == "" {
+		return nil
+	}
+
+	// ボディを先に書き込み、メタデータがあればボディも揃っている状態にする
+	bodyPath := c.path(url, ".body")
+	if err := cmd.WriteOutFile(bodyPath, res.Body); err != nil {
+		return errors.WithMessage(err, "failed to write cached body")
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrapf(err, "could not marshal: %v", e)
+	}
+	metaPath := c.path(url, ".json")
+	if err := cmd.WriteOutFile(metaPath, b); err != nil {
+		return errors.WithMessage(err, "failed to write cache entry")
+	}
+	return nil
+}
+
+func (c *cache) entry(url string) (cacheEntry, bool) {
+	var e cacheEntry
+	b, err := ioutil.ReadFile(c.path(url, ".json"))
+	if err != nil {
+		return e, false
+	}
+	if err := json.Unmarshal(b, &e); err != nil || e.URL != url {
+		return e, false
+	}
+	return e, true
+}
+
+func (c *cache) path(url, ext string) string {
+	sum := sha1.Sum([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+ext)
+}
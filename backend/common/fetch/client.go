@@ -0,0 +1,324 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultUserAgent はfetch時に送るデフォルトのUser-Agent
+const DefaultUserAgent = "nahahafetch/1.0 (+https://github.com/ohnishi/nahaha)"
+
+// Config はClientの設定を表す。
+type Config struct {
+	// Timeout は1リクエストあたりのタイムアウト
+	Timeout time.Duration
+	// UserAgent はリクエストに付与するUser-Agent
+	UserAgent string
+	// MaxRetry は初回リクエスト以降にリトライする最大回数
+	MaxRetry uint
+	// MinBackoff はリトライ時の待ち時間の初期値
+	MinBackoff time.Duration
+	// MaxBackoff はリトライ時の待ち時間の上限
+	MaxBackoff time.Duration
+	// CacheDir はETag/Last-Modifiedとボディを保存するディレクトリ。
+	// 指定された場合は条件付きGETを送り、304の場合は前回のボディを再利用する。
+	CacheDir string
+	// RecordDir は受け取った全てのレスポンスを記録するディレクトリ(空の場合は記録しない)
+	RecordDir string
+	// ReplayDir はRecordDirに記録したレスポンスを返すディレクトリ。
+	// 指定された場合はネットワークにアクセスせずに記録したレスポンスを返す。
+	ReplayDir string
+	// RespectRobots がtrueの場合はホストごとにrobots.txtを取得し、禁止されたURLにはアクセスしない
+	RespectRobots bool
+	// HostDelay は同じホストへのリクエストの最小間隔。
+	// RespectRobotsがtrueでrobots.txtのCrawl-delayの方が長い場合はCrawl-delayを使う。
+	HostDelay time.Duration
+}
+
+// DefaultConfig はデフォルトのClient設定を返す。
+func DefaultConfig() Config {
+	return Config{
+		Timeout:    30 * time.Second,
+		UserAgent:  DefaultUserAgent,
+		MaxRetry:   3,
+		MinBackoff: time.Second,
+		MaxBackoff: 30 * time.Second,
+
+		RespectRobots: true,
+		HostDelay:     time.Second,
+	}
+}
+
+// Client はタイムアウトとリトライを備えたHTTPクライアント
+type Client struct {
+	config Config
+	http   *http.Client
+	cache  *cache
+
+	recorders  []Recorder
+	politeness *politeness
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewClient はconfigの設定でClientを生成する。
+func NewClient(config Config) *Client {
+	c := &Client{
+		config: config,
+		http:   &http.Client{Timeout: config.Timeout},
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+
+		politeness: newPoliteness(),
+	}
+	switch {
+	case config.ReplayDir != "":
+		c.http.Transport = NewReplayTransport(config.ReplayDir)
+	case config.RecordDir != "":
+		c.http.Transport = NewRecordTransport(config.RecordDir, nil)
+	}
+	if config.CacheDir != "" {
+		c.cache = &cache{dir: config.CacheDir}
+	}
+	return c
+}
+
+// AddRecorder はClientが行ったHTTPのやり取りを記録するRecorderを追加する。
+// リトライした場合は失敗したやり取りも含めて全て記録する。
+func (c *Client) AddRecorder(r Recorder) {
+	c.recorders = append(c.recorders, r)
+}
+
+// Response はfetchしたレスポンスを表す。
+type Response struct {
+	// URL はリダイレクト後の最終的なURL
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Retries はレスポンスを得るまでにリトライした回数
+	Retries uint
+	// NotModified は304を受け取りキャッシュしていたボディを再利用した場合にtrueになる
+	NotModified bool
+}
+
+// StatusError は期待しないステータスコードが返されたことを表す。
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status code expected 200 but was %d : url=%s", e.StatusCode, e.URL)
+}
+
+// Get はurlにGETリクエストを送りレスポンスを返す。
+// 通信エラーとリトライ可能なステータスコードの場合はバックオフしながらリトライする。
+// 最終的にステータスコードが200以外の場合は*StatusErrorを返す。
+// キャッシュが有効で304が返された場合は、キャッシュしていたボディを200のレスポンスとして返す。
+// RespectRobotsが有効でrobots.txtで禁止されている場合はリクエストを送らずにErrDisallowedを返す。
+func (c *Client) Get(ctx context.Context, url string) (*Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request : %s", url)
+	}
+	return c.Do(ctx, req)
+}
+
+// Do はreqを送信してレスポンスを返す。リトライの挙動はGetと同じ。
+func (c *Client) Do(ctx context.Context, req *http.Request) (*Response, error) {
+	return c.send(ctx, req, false)
+}
+
+// reqをリトライしながら送信する。
+// robotsTxtがtrueの場合はrobots.txt自体の取得として、robots.txtの確認とキャッシュを行わずにアクセス間隔だけを空ける。
+func (c *Client) send(ctx context.Context, req *http.Request, robotsTxt bool) (*Response, error) {
+	if req.Header.Get("User-Agent") == "" && c.config.UserAgent != "" {
+		req.Header.Set("User-Agent", c.config.UserAgent)
+	}
+	cache := c.cache
+	if robotsTxt || req.Method != http.MethodGet {
+		cache = nil
+	}
+	if cache != nil {
+		cache.setConditionalHeaders(req)
+	}
+
+	url := req.URL.String()
+	for retry := uint(0); ; retry++ {
+		if err := c.wait(ctx, req, robotsTxt); err != nil {
+			return nil, err
+		}
+		res, err := c.do(ctx, req)
+		if err == nil {
+			res.Retries = retry
+			if res.StatusCode == http.StatusNotModified && cache != nil {
+				body, err := cache.body(url)
+				if err != nil {
+					return nil, err
+				}
+				res.StatusCode = http.StatusOK
+				res.Body = body
+				res.NotModified = true
+				return res, nil
+			}
+			if res.StatusCode == http.StatusOK {
+				if cache != nil {
+					if err := cache.store(url, res); err != nil {
+						return nil, err
+					}
+				}
+				return res, nil
+			}
+			err = &StatusError{URL: url, StatusCode: res.StatusCode}
+			if !retryableStatus(res.StatusCode) {
+				return res, err
+			}
+		} else {
+			err = errors.Wrapf(err, "failed request url : %s", url)
+			if errors.Is(err, ErrNotRecorded) {
+				// リプレイ時に記録が無いものはリトライしても取得できない
+				return nil, err
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, errors.Wrapf(ctx.Err(), "failed request url : %s", url)
+		}
+		if retry >= c.config.MaxRetry {
+			return res, err
+		}
+
+		wait := c.backoff(retry)
+		if res != nil {
+			if d, ok := retryAfter(res.Header); ok {
+				if d > c.config.MaxBackoff {
+					// 待ち時間の上限を超えて待つよりも諦めて次のURLに進む
+					return res, err
+				}
+				wait = d
+			}
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, errors.Wrapf(err, "failed request url : %s", url)
+		}
+	}
+}
+
+// リクエストを送る前にrobots.txtを確認し、同じホストへのリクエストの間隔を空ける
+// robotsTxtがtrueの場合はrobots.txtを確認しない
+func (c *Client) wait(ctx context.Context, req *http.Request, robotsTxt bool) error {
+	if c.config.RespectRobots && !robotsTxt {
+		return c.checkPolicy(ctx, req)
+	}
+	if err := c.politeness.wait(ctx, req.URL.Scheme+"://"+req.URL.Host, c.config.HostDelay); err != nil {
+		return errors.Wrapf(err, "failed request url : %s", req.URL.String())
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, req *http.Request) (*Response, error) {
+	sentAt := time.Now()
+	res, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+	for _, r := range c.recorders {
+		e := Exchange{
+			Request:    res.Request,
+			Proto:      res.Proto,
+			Status:     res.Status,
+			StatusCode: res.StatusCode,
+			Header:     res.Header,
+			Body:       body,
+			Time:       sentAt,
+		}
+		if err := r.Record(e); err != nil {
+			return nil, err
+		}
+	}
+	return &Response{
+		URL:        res.Request.URL.String(),
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       body,
+	}, nil
+}
+
+// backoff はretry回目のリトライ前の待ち時間をジッター付きの指数バックオフで返す
+func (c *Client) backoff(retry uint) time.Duration {
+	d := c.config.MinBackoff
+	for i := uint(0); i < retry && d < c.config.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.config.MaxBackoff {
+		d = c.config.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 待ち時間の半分をランダムにずらして同時リトライが重ならないようにする
+	return d/2 + time.Duration(c.rand.Int63n(int64(d/2)+1))
+}
+
+// リトライすれば成功する可能性があるステータスコードならtrueを返す
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Retry-Afterヘッダーから待ち時間を返す
+func retryAfter(h http.Header) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// dだけ待つ。待っている間にctxがキャンセルされた場合はエラーを返す
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,182 @@
+package fetch_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/pkg/errors"
+)
+
+// テスト用に待ち時間を短くした設定を返す
+func testConfig() fetch.Config {
+	config := fetch.DefaultConfig()
+	config.MinBackoff = time.Millisecond
+	config.MaxBackoff = 2 * time.Second
+	config.RespectRobots = false
+	config.HostDelay = 0
+	return config
+}
+
+// 順にstatusesのステータスコードとRetry-Afterを返し、最後は200を返すサーバー
+type statusServer struct {
+	statuses    []int
+	retryAfters []string
+
+	mu       sync.Mutex
+	requests []time.Time
+}
+
+func (s *statusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	n := len(s.requests)
+	s.requests = append(s.requests, time.Now())
+	s.mu.Unlock()
+
+	if n < len(s.statuses) {
+		if n < len(s.retryAfters) && s.retryAfters[n] != "" {
+			w.Header().Set("Retry-After", s.retryAfters[n])
+		}
+		w.WriteHeader(s.statuses[n])
+		return
+	}
+	_, _ = w.Write([]byte("ok"))
+}
+
+func TestClientRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		retryAfters []string
+		maxRetry    uint
+		wantStatus  int
+		wantRetries uint
+		wantWait    time.Duration
+	}{
+		{
+			name:        "429 with Retry-After",
+			statuses:    []int{http.StatusTooManyRequests},
+			retryAfters: []string{"1"},
+			maxRetry:    3,
+			wantStatus:  http.StatusOK,
+			wantRetries: 1,
+			wantWait:    time.Second,
+		},
+		{
+			name:        "503 with Retry-After",
+			statuses:    []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			retryAfters: []string{"0", "1"},
+			maxRetry:    3,
+			wantStatus:  http.StatusOK,
+			wantRetries: 2,
+			wantWait:    time.Second,
+		},
+		{
+			name:        "Retry-After longer than MaxBackoff gives up",
+			statuses:    []int{http.StatusServiceUnavailable},
+			retryAfters: []string{"60"},
+			maxRetry:    3,
+			wantStatus:  http.StatusServiceUnavailable,
+		},
+		{
+			name:        "give up after max retries",
+			statuses:    []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+			maxRetry:    2,
+			wantStatus:  http.StatusServiceUnavailable,
+			wantRetries: 2,
+		},
+		{
+			name:       "404 is not retried",
+			statuses:   []int{http.StatusNotFound},
+			maxRetry:   3,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &statusServer{statuses: tt.statuses, retryAfters: tt.retryAfters}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			config := testConfig()
+			config.MaxRetry = tt.maxRetry
+			start := time.Now()
+			res, err := fetch.NewClient(config).Get(context.Background(), ts.URL+"/a")
+			elapsed := time.Since(start)
+
+			if tt.wantStatus == http.StatusOK {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(res.Body) != "ok" {
+					t.Errorf("Body = %q, want %q", res.Body, "ok")
+				}
+				if res.Retries != tt.wantRetries {
+					t.Errorf("Retries = %d, want %d", res.Retries, tt.wantRetries)
+				}
+			} else {
+				var statusErr *fetch.StatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+					t.Fatalf("err = %v, want StatusError %d", err, tt.wantStatus)
+				}
+			}
+			if want := int(tt.wantRetries) + 1; len(s.requests) != want {
+				t.Errorf("requests = %d, want %d", len(s.requests), want)
+			}
+			if elapsed < tt.wantWait {
+				t.Errorf("elapsed = %v, want at least %v", elapsed, tt.wantWait)
+			}
+			if tt.wantWait == 0 && elapsed >= time.Second {
+				t.Errorf("elapsed = %v, want no Retry-After wait", elapsed)
+			}
+		})
+	}
+}
+
+func TestClientNotModified(t *testing.T) {
+	const etag = `"v1"`
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte("cached body"))
+	}))
+	defer ts.Close()
+
+	config := testConfig()
+	config.CacheDir = t.TempDir()
+	c := fetch.NewClient(config)
+
+	res, err := c.Get(context.Background(), ts.URL+"/subject.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.NotModified || string(res.Body) != "cached body" {
+		t.Fatalf("first response = (%v, %q), want (false, %q)", res.NotModified, res.Body, "cached body")
+	}
+
+	res, err = c.Get(context.Background(), ts.URL+"/subject.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.NotModified {
+		t.Error("NotModified = false, want true")
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if string(res.Body) != "cached body" {
+		t.Errorf("Body = %q, want %q", res.Body, "cached body")
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+}
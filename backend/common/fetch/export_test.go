@@ -0,0 +1,14 @@
+package fetch
+
+import (
+	"net/url"
+	"time"
+)
+
+var ExportMatchRobotsPattern = matchRobotsPattern
+
+// ExportParseRobots はrobots.txtをパースして、URLへのアクセスが許可されているかを返す関数とCrawl-delayを返す
+func ExportParseRobots(b []byte, agent string) (func(u *url.URL) bool, time.Duration) {
+	r := parseRobots(b, agent)
+	return r.allowed, r.crawlDelay
+}
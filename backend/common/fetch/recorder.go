@@ -0,0 +1,85 @@
+package fetch
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/common/warc"
+)
+
+// Exchange は1回のHTTPリクエストとレスポンスのやり取りを表す
+type Exchange struct {
+	// Request は実際に送信したリクエスト(リダイレクトした場合はリダイレクト先へのリクエスト)
+	Request    *http.Request
+	Proto      string
+	Status     string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Time はリクエストを送信した時刻
+	Time time.Time
+}
+
+// Recorder はClientが行ったHTTPのやり取りを記録する
+type Recorder interface {
+	Record(e Exchange) error
+}
+
+// WARCRecorder はHTTPのやり取りをrequestとresponseのレコードとしてWARCファイルに書き込む
+type WARCRecorder struct {
+	w *warc.Writer
+}
+
+// NewWARCRecorder はwに書き込むWARCRecorderを生成する
+func NewWARCRecorder(w *warc.Writer) *WARCRecorder {
+	return &WARCRecorder{w: w}
+}
+
+// Record はやり取りをWARCファイルに書き込む
+func (r *WARCRecorder) Record(e Exchange) error {
+	uri := e.Request.URL.String()
+	reqID := warc.NewRecordID()
+	err := r.w.Write(warc.Record{
+		Type:        warc.TypeRequest,
+		ID:          reqID,
+		Date:        e.Time,
+		TargetURI:   uri,
+		ContentType: "application/http;msgtype=request",
+		Block:       requestBlock(e.Request),
+	})
+	if err != nil {
+		return err
+	}
+	return r.w.Write(warc.Record{
+		Type:          warc.TypeResponse,
+		Date:          e.Time,
+		TargetURI:     uri,
+		ContentType:   "application/http;msgtype=response",
+		ConcurrentTo:  reqID,
+		PayloadDigest: warc.Digest(e.Body),
+		Block:         responseBlock(e),
+	})
+}
+
+// リクエストをHTTPメッセージの形式で返す
+func requestBlock(req *http.Request) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	fmt.Fprintf(&b, "Host: %s\r\n", req.URL.Host)
+	_ = req.Header.Write(&b)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// レスポンスをHTTPメッセージの形式で返す。
+// HTTP/2で受け取ったレスポンスもWARCのHTTPメッセージとして読めるよう、ステータス行は常にHTTP/1.1にする
+func responseBlock(e Exchange) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "HTTP/1.1 %s\r\n", e.Status)
+	_ = e.Header.Write(&b)
+	b.WriteString("\r\n")
+	b.Write(e.Body)
+	return b.Bytes()
+}
@@ -0,0 +1,196 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/pkg/errors"
+)
+
+// ErrNotRecorded はリプレイ時に記録されていないリクエストが送られたことを表す
+var ErrNotRecorded = errors.New("response is not recorded")
+
+// tapeEntry は記録したレスポンスのメタデータ
+type tapeEntry struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Proto      string      `json:"proto"`
+	Status     string      `json:"status"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+}
+
+// 記録を開始した時刻を保存するファイル名
+const tapeInfoFileName = "tape.json"
+
+// tapeInfo は記録全体のメタデータ
+type tapeInfo struct {
+	// RecordedAt は記録を開始した時刻。リプレイ時はこの時刻のスナップショットとしてfetchする
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// tape はリクエストごとのレスポンスをディレクトリに <sha1>.json と <sha1>.body で保存する
+type tape struct {
+	dir string
+}
+
+func (t *tape) path(req *http.Request, ext string) string {
+	sum := sha1.Sum([]byte(req.Method + " " + req.URL.String()))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:])+ext)
+}
+
+// RecordTransport は受け取ったレスポンスをディレクトリに記録するhttp.RoundTripper。
+// 同じリクエストが複数回送られた場合は最後のレスポンスを残す。
+type RecordTransport struct {
+	tape  tape
+	base  http.RoundTripper
+	start time.Time
+
+	mu      sync.Mutex
+	started bool
+}
+
+// NewRecordTransport はbaseで送信したレスポンスをdirに記録するRecordTransportを生成する。
+// baseがnilの場合はhttp.DefaultTransportを使う。
+func NewRecordTransport(dir string, base http.RoundTripper) *RecordTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RecordTransport{tape: tape{dir: dir}, base: base, start: time.Now()}
+}
+
+// RoundTrip はreqを送信し、レスポンスを記録してから返す
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response body")
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	e := tapeEntry{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		Proto:      res.Proto,
+		Status:     res.Status,
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+	}
+	if err := t.store(req, e, body); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (t *RecordTransport) store(req *http.Request, e tapeEntry, body []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.started {
+		if err := t.storeInfo(); err != nil {
+			return err
+		}
+		t.started = true
+	}
+	// ボディを先に書き込み、メタデータがあればボディも揃っている状態にする
+	bodyPath := t.tape.path(req, ".body")
+	if err := cmd.WriteOutFile(bodyPath, body); err != nil {
+		return errors.WithMessage(err, "failed to write recorded body")
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrapf(err, "could not marshal: %v", e)
+	}
+	metaPath := t.tape.path(req, ".json")
+	if err := cmd.WriteOutFile(metaPath, b); err != nil {
+		return errors.WithMessage(err, "failed to write recorded entry")
+	}
+	return nil
+}
+
+func (t *RecordTransport) storeInfo() error {
+	info := tapeInfo{RecordedAt: t.start}
+	b, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrapf(err, "could not marshal: %v", info)
+	}
+	path := filepath.Join(t.tape.dir, tapeInfoFileName)
+	if err := cmd.WriteOutFile(path, b); err != nil {
+		return errors.WithMessage(err, "failed to write record info")
+	}
+	return nil
+}
+
+// RecordedAt はRecordTransportがdirに記録を開始した時刻を返す
+func RecordedAt(dir string) (time.Time, error) {
+	path := filepath.Join(dir, tapeInfoFileName)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to read record info: %s", path)
+	}
+	var info tapeInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		return time.Time{}, errors.Wrapf(err, "could not unmarshal record info: %s", path)
+	}
+	return info.RecordedAt, nil
+}
+
+// ReplayTransport はRecordTransportが記録したレスポンスを返すhttp.RoundTripper。
+// ネットワークには一切アクセスせず、記録されていないリクエストにはErrNotRecordedを返す。
+type ReplayTransport struct {
+	tape tape
+}
+
+// NewReplayTransport はdirに記録したレスポンスを返すReplayTransportを生成する
+func NewReplayTransport(dir string) *ReplayTransport {
+	return &ReplayTransport{tape: tape{dir: dir}}
+}
+
+// RoundTrip はreqに対して記録したレスポンスを返す
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	b, err := ioutil.ReadFile(t.tape.path(req, ".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrapf(ErrNotRecorded, "%s %s", req.Method, url)
+		}
+		return nil, errors.Wrapf(err, "failed to read recorded entry: %s", url)
+	}
+	var e tapeEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, errors.Wrapf(err, "could not unmarshal recorded entry: %s", url)
+	}
+	if e.Method != req.Method || e.URL != url {
+		return nil, errors.Wrapf(ErrNotRecorded, "%s %s", req.Method, url)
+	}
+	bodyPath := t.tape.path(req, ".body")
+	body, err := ioutil.ReadFile(bodyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read recorded body: %s", bodyPath)
+	}
+
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         e.Proto,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,277 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDisallowed はrobots.txtでアクセスが禁止されているURLへのリクエストを表す
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// robotsRule はrobots.txtのAllow/Disallowの1行を表す
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robots はホストのrobots.txtのうちUser-Agentに適用されるルールを表す
+type robots struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// allowed はURLのパスへのアクセスが許可されていればtrueを返す。
+// 最も長くマッチしたルールを優先し、同じ長さならAllowを優先する。
+func (r *robots) allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allow, length := true, -1
+	for _, rule := range r.rules {
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > length || (len(rule.pattern) == length && rule.allow) {
+			allow, length = rule.allow, len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// robots.txtのパターン(*は任意の文字列、末尾の$はパスの終端)がパスの先頭にマッチすればtrueを返す
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+	for _, part := range parts[1 : len(parts)-1] {
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(rest, last)
+	}
+	return strings.Contains(rest, last)
+}
+
+// parseRobots はrobots.txtからagentに適用されるルールを返す。
+// agentは大文字小文字を区別せずにUser-agentのプロダクトトークンと完全一致で比べ、
+// 一致するグループが無い場合は * のグループを使う。
+func parseRobots(b []byte, agent string) *robots {
+	agent = strings.ToLower(agent)
+
+	var specific, any *robots
+	var current []*robots
+	inRules := false
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				// ルールの後のUser-agentは新しいグループの開始
+				current, inRules = nil, false
+			}
+			// User-agentはプロダクトトークン(例: nahaha/1.0 の nahaha)の完全一致で比べる。
+			// 空のUser-agentはどのクローラーにも一致しない
+			name := strings.ToLower(robotsAgent(value))
+			switch {
+			case name == "*":
+				if any == nil {
+					any = &robots{}
+				}
+				current = append(current, any)
+			case name != "" && name == agent:
+				if specific == nil {
+					specific = &robots{}
+				}
+				current = append(current, specific)
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				// 空のDisallowは全て許可を意味する
+				continue
+			}
+			for _, r := range current {
+				r.rules = append(r.rules, robotsRule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			inRules = true
+			sec, err := strconv.ParseFloat(value, 64)
+			if err != nil || sec < 0 {
+				continue
+			}
+			for _, r := range current {
+				r.crawlDelay = time.Duration(sec * float64(time.Second))
+			}
+		}
+	}
+
+	if specific != nil {
+		return specific
+	}
+	if any != nil {
+		return any
+	}
+	return &robots{}
+}
+
+// robotsAgent はUser-Agentからrobots.txtのグループを選ぶためのプロダクトトークンを返す
+func robotsAgent(userAgent string) string {
+	token := userAgent
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	return token
+}
+
+// robotsEntry はホストごとのrobots.txtの取得結果を表す
+type robotsEntry struct {
+	ready  chan struct{}
+	robots *robots
+	err    error
+}
+
+// politeness はホストごとのrobots.txtとアクセス間隔を管理する
+type politeness struct {
+	mu     sync.Mutex
+	robots map[string]*robotsEntry
+	next   map[string]time.Time
+}
+
+func newPoliteness() *politeness {
+	return &politeness{
+		robots: make(map[string]*robotsEntry),
+		next:   make(map[string]time.Time),
+	}
+}
+
+// robotsFor はホストのrobots.txtを返す。
+// 同じホストに対しては取得に成功するまで取得し、取得中の場合は取得が終わるまで待つ。
+// 取得に失敗した場合は結果を残さず、次の呼び出しで取得し直す。
+func (p *politeness) robotsFor(ctx context.Context, host string, load func() (*robots, error)) (*robots, error) {
+	p.mu.Lock()
+	e, ok := p.robots[host]
+	if !ok {
+		e = &robotsEntry{ready: make(chan struct{})}
+		p.robots[host] = e
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		e.robots, e.err = load()
+		if e.err != nil {
+			p.mu.Lock()
+			delete(p.robots, host)
+			p.mu.Unlock()
+		}
+		close(e.ready)
+	}
+	select {
+	case <-e.ready:
+		return e.robots, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// wait はホストへの前回のリクエストからdelay以上の間隔が空くまで待つ。
+// 同時に呼ばれた場合も順番に間隔を空けて枠を割り当てる。
+func (p *politeness) wait(ctx context.Context, host string, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	p.next[host] = at.Add(delay)
+	p.mu.Unlock()
+
+	return sleep(ctx, time.Until(at))
+}
+
+// checkPolicy はreqのホストのrobots.txtを確認し、許可されていればクロール間隔を空けてから返す。
+// 禁止されている場合はErrDisallowedを返し、robots.txtを取得できない場合は取得のエラーを返す。
+func (c *Client) checkPolicy(ctx context.Context, req *http.Request) error {
+	host := req.URL.Scheme + "://" + req.URL.Host
+	r, err := c.politeness.robotsFor(ctx, host, func() (*robots, error) {
+		return c.loadRobots(ctx, host)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed request url : %s", req.URL.String())
+	}
+	if !r.allowed(req.URL) {
+		return errors.Wrapf(ErrDisallowed, "url : %s", req.URL.String())
+	}
+
+	delay := c.config.HostDelay
+	if r.crawlDelay > delay {
+		delay = r.crawlDelay
+	}
+	if err := c.politeness.wait(ctx, host, delay); err != nil {
+		return errors.Wrapf(err, "failed request url : %s", req.URL.String())
+	}
+	return nil
+}
+
+// ホストのrobots.txtを取得する。通常のリクエストと同じくバックオフしながらリトライする。
+// 404などでrobots.txtが無い場合は全て許可し、5xxや通信エラーで取得できない場合はエラーを返す。
+func (c *Client) loadRobots(ctx context.Context, host string) (*robots, error) {
+	robotsURL := host + "/robots.txt"
+	req, err := http.NewRequest(http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request : %s", robotsURL)
+	}
+	res, err := c.send(ctx, req, true)
+	if err != nil {
+		var se *StatusError
+		if errors.As(err, &se) && se.StatusCode < 500 && !retryableStatus(se.StatusCode) {
+			return &robots{}, nil
+		}
+		return nil, errors.WithMessage(err, "failed to fetch robots.txt")
+	}
+	return parseRobots(res.Body, robotsAgent(c.config.UserAgent)), nil
+}
@@ -0,0 +1,98 @@
+package fetch_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+)
+
+func TestMatchRobotsPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/", true},
+		{"/", "/news/", true},
+		{"/news", "/news/a.html", true},
+		{"/news", "/sports/news", false},
+		{"/news/", "/news", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/a/b/index.php?x=1", true},
+		{"/*.php", "/index.html", false},
+		{"/*.php$", "/index.php", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/news$", "/news", true},
+		{"/news$", "/news/", false},
+		{"/a*b*c", "/a-b-c", true},
+		{"/a*b*c", "/a-c-b", false},
+		{"*", "/anything", true},
+	}
+	for _, tt := range tests {
+		if got := fetch.ExportMatchRobotsPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchRobotsPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+const robotsTxt = `# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public/
+Disallow: /*.cgi$
+Crawl-delay: 2
+
+User-agent: nahaha
+User-agent: otherbot
+Disallow: /nahaha-only/
+Crawl-delay: 0.5
+
+User-agent: badbot
+Disallow: /
+`
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name       string
+		txt        string
+		agent      string
+		url        string
+		want       bool
+		crawlDelay time.Duration
+	}{
+		{"any group allows", robotsTxt, "somebot", "https://example.com/news/", true, 2 * time.Second},
+		{"any group disallows", robotsTxt, "somebot", "https://example.com/private/a", false, 2 * time.Second},
+		{"longer allow wins", robotsTxt, "somebot", "https://example.com/private/public/a", true, 2 * time.Second},
+		{"anchored pattern", robotsTxt, "somebot", "https://example.com/bbs/read.cgi", false, 2 * time.Second},
+		{"anchored pattern with query", robotsTxt, "somebot", "https://example.com/bbs/read.cgi?k=1", true, 2 * time.Second},
+		{"specific group replaces any group", robotsTxt, "nahaha", "https://example.com/private/a", true, 500 * time.Millisecond},
+		{"specific group disallows", robotsTxt, "nahaha", "https://example.com/nahaha-only/a", false, 500 * time.Millisecond},
+		{"agent is case insensitive", robotsTxt, "Nahaha", "https://example.com/nahaha-only/a", false, 500 * time.Millisecond},
+		{"product token matches exactly", robotsTxt, "nahahabot", "https://example.com/private/a", false, 2 * time.Second},
+		{"product token with version", "User-agent: nahaha/1.0\nDisallow: /a\n", "nahaha", "https://example.com/a", false, 0},
+		{"empty user-agent matches no agent", "User-agent:\nDisallow: /\n", "somebot", "https://example.com/a", true, 0},
+		{"empty user-agent starts a new group", "User-agent: *\nDisallow: /a\nUser-agent:\nDisallow: /b\n", "somebot", "https://example.com/b", true, 0},
+		{"disallow all", robotsTxt, "badbot", "https://example.com/", false, 0},
+		{"robots.txt is always allowed", robotsTxt, "badbot", "https://example.com/robots.txt", true, 0},
+		{"empty disallow allows all", "User-agent: *\nDisallow:\n", "somebot", "https://example.com/a", true, 0},
+		{"empty robots.txt", "", "somebot", "https://example.com/a", true, 0},
+		{"invalid crawl-delay is ignored", "User-agent: *\nCrawl-delay: soon\n", "somebot", "https://example.com/a", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			allowed, crawlDelay := fetch.ExportParseRobots([]byte(tt.txt), tt.agent)
+			if got := allowed(u); got != tt.want {
+				t.Errorf("allowed(%s) = %v, want %v", tt.url, got, tt.want)
+			}
+			if crawlDelay != tt.crawlDelay {
+				t.Errorf("crawlDelay = %v, want %v", crawlDelay, tt.crawlDelay)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package opml
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// OPML はOPML 2.0のドキュメントを表す
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    Head     `xml:"head"`
+	Body    Body     `xml:"body"`
+}
+
+// Head はOPMLのhead要素を表す
+type Head struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+// Body はOPMLのbody要素を表す
+type Body struct {
+	Outlines []Outline `xml:"outline"`
+}
+
+// Outline はOPMLのoutline要素を表す。フィードの場合はXMLURLを持つ。
+type Outline struct {
+	Text     string `xml:"text,attr"`
+	Title    string `xml:"title,attr,omitempty"`
+	Type     string `xml:"type,attr,omitempty"`
+	XMLURL   string `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string `xml:"htmlUrl,attr,omitempty"`
+	Category string `xml:"category,attr,omitempty"`
+	Language string `xml:"language,attr,omitempty"`
+	// Weight とEnabled はnahaha独自の属性で、フィードの重みと有効/無効を表す。
+	// 他のリーダーが出力したOPMLでは省略されるので、未指定と区別できるよう文字列で持つ
+	Weight   string    `xml:"weight,attr,omitempty"`
+	Enabled  string    `xml:"enabled,attr,omitempty"`
+	Outlines []Outline `xml:"outline"`
+}
+
+// Parse はrからOPMLを読み込む
+func Parse(r io.Reader) (*OPML, error) {
+	var doc OPML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "failed to parse OPML")
+	}
+	return &doc, nil
+}
+
+// Write はOPMLをインデント付きでwに書き込む
+func Write(w io.Writer, doc *OPML) error {
+	if doc.Version == "" {
+		doc.Version = "2.0"
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Wrap(err, "failed to write OPML")
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(doc); err != nil {
+		return errors.Wrap(err, "failed to write OPML")
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return errors.Wrap(err, "failed to write OPML")
+	}
+	return nil
+}
+
+// Feeds は入れ子のoutlineを平坦にしてフィード(XMLURLを持つoutline)の一覧を返す。
+// 親outlineのtextはフィードにcategoryが無い場合のカテゴリとして引き継ぐ。
+func (o *OPML) Feeds() []Outline {
+	return flatten(o.Body.Outlines, "")
+}
+
+func flatten(outlines []Outline, category string) []Outline {
+	var feeds []Outline
+	for _, o := range outlines {
+		children := o.Outlines
+		if o.XMLURL != "" {
+			if o.Category == "" {
+				o.Category = category
+			}
+			o.Outlines = nil
+			feeds = append(feeds, o)
+		}
+		if len(children) > 0 {
+			feeds = append(feeds, flatten(children, o.Text)...)
+		}
+	}
+	return feeds
+}
@@ -0,0 +1,120 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/charset"
+)
+
+// Document はサイトマップのXMLを表す。サイトマップインデックスの場合はSitemapsを、
+// 通常のサイトマップの場合はURLsを持つ。
+type Document struct {
+	// Sitemaps はサイトマップインデックスのsitemap要素
+	Sitemaps []Sitemap
+	// URLs はサイトマップのurl要素
+	URLs []URL
+}
+
+// IsIndex はサイトマップインデックスならtrueを返す
+func (d *Document) IsIndex() bool {
+	return len(d.Sitemaps) > 0
+}
+
+// Sitemap はサイトマップインデックスのsitemap要素を表す
+type Sitemap struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// URL はサイトマップのurl要素を表す。Google News形式のサイトマップではNewsを持つ
+type URL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+	News    *News  `xml:"news"`
+}
+
+// News はGoogle News形式のサイトマップのnews:news要素を表す
+type News struct {
+	Publication     Publication `xml:"publication"`
+	PublicationDate string      `xml:"publication_date"`
+	Title           string      `xml:"title"`
+}
+
+// Publication はnews:publication要素を表す
+type Publication struct {
+	Name     string `xml:"name"`
+	Language string `xml:"language"`
+}
+
+type document struct {
+	XMLName  xml.Name
+	Sitemaps []Sitemap `xml:"sitemap"`
+	URLs     []URL     `xml:"url"`
+}
+
+// Parse はサイトマップまたはサイトマップインデックスのXMLをパースする。
+// gzipで圧縮されている場合は展開してからパースする。文字コードはXML宣言から判定する。
+func Parse(b []byte) (*Document, error) {
+	b, err := Decompress(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(b))
+	d.CharsetReader = charset.NewReaderLabel
+	var doc document
+	if err := d.Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "failed to parse sitemap")
+	}
+	switch doc.XMLName.Local {
+	case "sitemapindex", "urlset":
+	default:
+		return nil, errors.Errorf("unexpected root element of sitemap: %s", doc.XMLName.Local)
+	}
+	return &Document{Sitemaps: doc.Sitemaps, URLs: doc.URLs}, nil
+}
+
+// Decompress はbがgzipで圧縮されていれば展開して返す。圧縮されていなければそのまま返す
+func Decompress(b []byte) ([]byte, error) {
+	if len(b) < 2 || b[0] != 0x1f || b[1] != 0x8b {
+		return b, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decompress sitemap")
+	}
+	defer r.Close()
+	ret, err := ioutil.ReadAll(io.LimitReader(r, maxSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decompress sitemap")
+	}
+	return ret, nil
+}
+
+// 展開後のサイトマップの最大サイズ。プロトコルの上限の50MB
+const maxSize = 50 * 1024 * 1024
+
+// 日時のレイアウト。W3C Datetimeの各精度に対応する
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// ParseDate はlastmodやpublication_dateのW3C Datetimeをパースする。
+// タイムゾーンが無い場合はlocの時刻として扱う
+func ParseDate(s string, loc *time.Location) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("unexpected date in sitemap: %s", s)
+}
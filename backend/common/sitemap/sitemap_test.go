@@ -0,0 +1,149 @@
+package sitemap_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/common/sitemap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+const newsSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:news="http://www.google.com/schemas/sitemap-news/0.9">
+  <url>
+    <loc>https://example.com/articles/1</loc>
+    <lastmod>2020-10-31T15:00:00+09:00</lastmod>
+    <news:news>
+      <news:publication>
+        <news:name>Example News</news:name>
+        <news:language>ja</news:language>
+      </news:publication>
+      <news:publication_date>2020-10-31T14:00:00+09:00</news:publication_date>
+      <news:title>記事のタイトル</news:title>
+    </news:news>
+  </url>
+  <url>
+    <loc>https://example.com/about</loc>
+  </url>
+</urlset>`
+
+const sitemapIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap>
+    <loc>https://example.com/sitemap-1.xml</loc>
+    <lastmod>2020-10-31</lastmod>
+  </sitemap>
+  <sitemap>
+    <loc>https://example.com/sitemap-2.xml.gz</loc>
+  </sitemap>
+</sitemapindex>`
+
+func TestParse(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	if _, err := w.Write([]byte(newsSitemap)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sjis, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(`<?xml version="1.0" encoding="Shift_JIS"?><urlset><url><loc>https://example.com/テスト</loc></url></urlset>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	news := &sitemap.Document{
+		URLs: []sitemap.URL{
+			{
+				Loc:     "https://example.com/articles/1",
+				LastMod: "2020-10-31T15:00:00+09:00",
+				News: &sitemap.News{
+					Publication:     sitemap.Publication{Name: "Example News", Language: "ja"},
+					PublicationDate: "2020-10-31T14:00:00+09:00",
+					Title:           "記事のタイトル",
+				},
+			},
+			{Loc: "https://example.com/about"},
+		},
+	}
+	tests := []struct {
+		name      string
+		b         []byte
+		want      *sitemap.Document
+		wantIndex bool
+		wantErr   bool
+	}{
+		{name: "news sitemap", b: []byte(newsSitemap), want: news},
+		{name: "gzip", b: gz.Bytes(), want: news},
+		{
+			name: "sitemap index",
+			b:    []byte(sitemapIndex),
+			want: &sitemap.Document{
+				Sitemaps: []sitemap.Sitemap{
+					{Loc: "https://example.com/sitemap-1.xml", LastMod: "2020-10-31"},
+					{Loc: "https://example.com/sitemap-2.xml.gz"},
+				},
+			},
+			wantIndex: true,
+		},
+		{
+			name: "Shift_JIS declaration",
+			b:    sjis,
+			want: &sitemap.Document{URLs: []sitemap.URL{{Loc: "https://example.com/テスト"}}},
+		},
+		{name: "empty urlset", b: []byte(`<urlset></urlset>`), want: &sitemap.Document{}},
+		{name: "HTML", b: []byte(`<html><body>Not Found</body></html>`), wantErr: true},
+		{name: "RSS", b: []byte(`<rss version="2.0"><channel></channel></rss>`), wantErr: true},
+		{name: "not XML", b: []byte(`not found`), wantErr: true},
+		{name: "broken gzip", b: []byte{0x1f, 0x8b, 0x00}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sitemap.Parse(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+			if got.IsIndex() != tt.wantIndex {
+				t.Errorf("IsIndex() = %v, want %v", got.IsIndex(), tt.wantIndex)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "2020-10-31T15:00:00+09:00", want: time.Date(2020, 10, 31, 15, 0, 0, 0, jst)},
+		{in: "2020-10-31T06:00:00Z", want: time.Date(2020, 10, 31, 15, 0, 0, 0, jst)},
+		{in: "2020-10-31T15:00:00.123+09:00", want: time.Date(2020, 10, 31, 15, 0, 0, 123000000, jst)},
+		{in: "2020-10-31T15:00+09:00", want: time.Date(2020, 10, 31, 15, 0, 0, 0, jst)},
+		{in: "2020-10-31T15:00:00", want: time.Date(2020, 10, 31, 15, 0, 0, 0, jst)},
+		{in: "2020-10-31", want: time.Date(2020, 10, 31, 0, 0, 0, 0, jst)},
+		{in: "", wantErr: true},
+		{in: "Sat, 31 Oct 2020 15:00:00 +0900", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := sitemap.ParseDate(tt.in, jst)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDate(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !got.Equal(tt.want) {
+			t.Errorf("ParseDate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
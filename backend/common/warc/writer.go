@@ -0,0 +1,192 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// レコードの種類
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeRequest  = "request"
+	TypeResponse = "response"
+)
+
+// Record はWARCファイルの1レコードを表す
+type Record struct {
+	// Type はWARC-Typeヘッダーの値
+	Type string
+	// ID はWARC-Record-IDヘッダーの値。空の場合は書き込み時に生成する
+	ID string
+	// Date はWARC-Dateヘッダーの値
+	Date time.Time
+	// TargetURI はWARC-Target-URIヘッダーの値
+	TargetURI string
+	// ContentType はレコードのブロックのContent-Type
+	ContentType string
+	// ConcurrentTo は同時に記録した関連レコードのID
+	ConcurrentTo string
+	// PayloadDigest はWARC-Payload-Digestヘッダーの値(HTTPレスポンスのボディのダイジェスト)
+	PayloadDigest string
+	// Block はレコードのブロック(HTTPメッセージなど)
+	Block []byte
+}
+
+// Writer はWARCファイルにレコードを書き込む。
+// ファイルがmaxSizeを超えると次のファイルにローテーションする。
+// 各レコードは個別のgzipメンバーとして圧縮し、ファイル名は <prefix>-<作成日時>-<連番>.warc.gz になる。
+type Writer struct {
+	dir     string
+	prefix  string
+	maxSize int64
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	seq  int
+}
+
+// NewWriter はdirにWARCファイルを書き込むWriterを生成する。
+// maxSizeが0以下の場合はローテーションしない。
+func NewWriter(dir, prefix string, maxSize int64) *Writer {
+	return &Writer{dir: dir, prefix: prefix, maxSize: maxSize}
+}
+
+// Digest はbのWARC-Payload-Digestなどに使うSHA-1ダイジェスト(sha1:<Base32>)を返す
+func Digest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// NewRecordID はWARC-Record-IDに使うURNを生成する
+func NewRecordID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	// UUID version 4
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Write はレコードを書き込む。
+func (w *Writer) Write(rec Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil || (w.maxSize > 0 && w.size >= w.maxSize) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	return w.write(rec)
+}
+
+// Close は書き込み中のファイルを閉じる
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	if err != nil {
+		return errors.Wrap(err, "failed to close WARC file")
+	}
+	return nil
+}
+
+// 書き込み中のファイルを閉じて新しいファイルを開き、先頭にwarcinfoレコードを書き込む
+func (w *Writer) rotate() error {
+	if w.f != nil {
+		if err := w.f.Close(); err != nil {
+			return errors.Wrap(err, "failed to close WARC file")
+		}
+		w.f = nil
+	}
+	if err := os.MkdirAll(w.dir, os.ModePerm); err != nil {
+		return errors.Wrapf(err, "failed to create directory: %s", w.dir)
+	}
+
+	w.seq++
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix, time.Now().Format("20060102150405"), w.seq)
+	path := filepath.Join(w.dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create WARC file: %s", path)
+	}
+	w.f = f
+	w.size = 0
+
+	return w.write(Record{
+		Type:        TypeWarcinfo,
+		Date:        time.Now(),
+		ContentType: "application/warc-fields",
+		Block:       []byte("software: nahahafetch\r\nformat: WARC File Format 1.0\r\n"),
+	})
+}
+
+func (w *Writer) write(rec Record) error {
+	if rec.ID == "" {
+		rec.ID = NewRecordID()
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := writeRecord(zw, rec); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "failed to compress WARC record")
+	}
+
+	n, err := w.f.Write(buf.Bytes())
+	w.size += int64(n)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write WARC record: %s", rec.TargetURI)
+	}
+	return nil
+}
+
+// WARC/1.0形式でレコードを書き込む
+func writeRecord(w io.Writer, rec Record) error {
+	var h bytes.Buffer
+	h.WriteString("WARC/1.0\r\n")
+	h.WriteString("WARC-Type: " + rec.Type + "\r\n")
+	h.WriteString("WARC-Record-ID: " + rec.ID + "\r\n")
+	h.WriteString("WARC-Date: " + rec.Date.UTC().Format(time.RFC3339) + "\r\n")
+	if rec.TargetURI != "" {
+		h.WriteString("WARC-Target-URI: " + rec.TargetURI + "\r\n")
+	}
+	if rec.ConcurrentTo != "" {
+		h.WriteString("WARC-Concurrent-To: " + rec.ConcurrentTo + "\r\n")
+	}
+	if rec.PayloadDigest != "" {
+		h.WriteString("WARC-Payload-Digest: " + rec.PayloadDigest + "\r\n")
+	}
+	if rec.ContentType != "" {
+		h.WriteString("Content-Type: " + rec.ContentType + "\r\n")
+	}
+	h.WriteString("Content-Length: " + strconv.Itoa(len(rec.Block)) + "\r\n")
+	h.WriteString("\r\n")
+
+	for _, b := range [][]byte{h.Bytes(), rec.Block, []byte("\r\n\r\n")} {
+		if _, err := w.Write(b); err != nil {
+			return errors.Wrapf(err, "failed to write WARC record: %s", rec.TargetURI)
+		}
+	}
+	return nil
+}
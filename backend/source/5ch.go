@@ -0,0 +1,127 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+	"github.com/ohnishi/nahaha/backend/common/env"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// 5ch板一覧URL
+const boardListURL = "https://menu.5ch.net/bbstable.html"
+
+// fiveCh は5chの板URLとsubject.txtの構成を表す
+var fiveCh = bbsSite{
+	name:             "5ch",
+	layout:           bbs.Nichannel,
+	encoding:         japanese.ShiftJIS,
+	removeTitleWords: replaceThreadTitleWords,
+}
+
+func init() {
+	Register(&fiveChSource{})
+}
+
+// fiveChSource は5chの板ごとのsubject.txtをニュースソースとして扱う
+type fiveChSource struct {
+	concurrency     int
+	hostConcurrency int
+	config          string
+	filter          boardFilter
+}
+
+func (*fiveChSource) Name() string { return "5ch" }
+
+func (*fiveChSource) Description() string { return "5ch thread" }
+
+func (s *fiveChSource) SetFetchFlags(f *pflag.FlagSet) {
+	f.IntVar(&s.concurrency, "concurrency", 16, "max number of subject.txt fetched concurrently")
+	f.IntVar(&s.hostConcurrency, "host-concurrency", 2, "max number of subject.txt fetched concurrently from the same host")
+	f.StringVar(&s.config, "config", env.ConfigDir("nahaha", "5ch.json"), "json file of board filters added to the built-in filters")
+	f.StringSliceVar(&s.filter.IncludeCategories, "include-category", nil, "board category to fetch (all categories if empty)")
+	f.StringSliceVar(&s.filter.ExcludeCategories, "exclude-category", nil, "board category not to fetch")
+	f.StringSliceVar(&s.filter.Boards, "board", nil, "board ID to fetch (all boards if empty)")
+}
+
+func (s *fiveChSource) Fetch(ctx context.Context, opts FetchOptions) error {
+	filter, err := readBoardFilter(s.config)
+	if err != nil {
+		return err
+	}
+	filter.merge(s.filter)
+	return fetchNews5ch(ctx, opts, filter, newFetchPool(s.concurrency, s.hostConcurrency))
+}
+
+type link struct {
+	text     string
+	href     string
+	category string
+}
+
+// fetchNews5ch  ニュースソースとなる5chの subject.txt を保存する
+func fetchNews5ch(ctx context.Context, opts FetchOptions, filter boardFilter, pool *fetchPool) error {
+	res, err := opts.Client.Get(ctx, boardListURL)
+	if err != nil {
+		return err
+	}
+	links, err := getLinks(transform.NewReader(bytes.NewReader(res.Body), japanese.ShiftJIS.NewDecoder()))
+	if err != nil {
+		return err
+	}
+	var targets []link
+	for _, l := range links {
+		if filter.match(l) {
+			// 板以外へのリンクURLや対象外の板はスキップする
+			targets = append(targets, l)
+		}
+	}
+
+	reg, err := readBoardRegistry(filepath.Join(opts.Dest, boardRegistryFileName))
+	if err != nil {
+		return err
+	}
+
+	return fetchBBS(ctx, opts, fiveCh, &manifest{}, reg, targets, filter.key(), pool)
+}
+
+// デコード済みの板一覧HTMLをパースして板URLと板名、カテゴリを取得する
+// カテゴリは<b>の見出しで、次の見出しまでのリンクがそのカテゴリに属する
+func getLinks(r io.Reader) ([]link, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read response body")
+		}
+		return nil, errors.Wrapf(err, "failed parse response body : %s", string(b))
+	}
+
+	var links []link
+	category := ""
+	doc.Find("b, a").Each(func(_ int, s *goquery.Selection) {
+		if goquery.NodeName(s) == "b" {
+			category = strings.TrimSpace(s.Text())
+			return
+		}
+		href, exists := s.Attr("href")
+		if exists {
+			l := link{
+				text:     s.Text(),
+				href:     href,
+				category: category,
+			}
+			links = append(links, l)
+		}
+	})
+	return links, nil
+}
@@ -0,0 +1,175 @@
+package source
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+	"github.com/pkg/errors"
+)
+
+// 5chの板の現在のURLを記録するファイル名
+const boardRegistryFileName = "5ch_boards.json"
+
+// registeredBoard は板の現在のURLと移転の履歴を表す
+type registeredBoard struct {
+	URL string `json:"url"`
+	// MovedFrom は移転を検出した時の移転元の板URL
+	MovedFrom string `json:"moved_from,omitempty"`
+	// MovedAt は移転を検出した時刻
+	MovedAt string `json:"moved_at,omitempty"`
+	// LastFetched はsubject.txtを最後に取得できた時刻
+	LastFetched string `json:"last_fetched,omitempty"`
+}
+
+// boardRegistry は板IDごとの現在の板URLをファイルに永続化する。
+// 板一覧が更新される前に移転した板も、前回検出した移転先から取得できるようにする。
+type boardRegistry struct {
+	path string
+
+	mu     sync.Mutex
+	boards map[string]registeredBoard
+}
+
+// readBoardRegistry はpathの板レジストリを読み込む。ファイルが無い場合は空のレジストリを返す
+func readBoardRegistry(path string) (*boardRegistry, error) {
+	r := &boardRegistry{path: path, boards: make(map[string]registeredBoard)}
+	b, err := cmd.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read file: %s", path)
+	}
+	if err := json.Unmarshal(b, &r.boards); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal json: %s", path)
+	}
+	return r, nil
+}
+
+// resolve は板一覧の板URLに対して取得に使う板URLを返す。
+// 板一覧のURLが移転を検出した移転元のままなら移転先のURLを返す。
+func (r *boardRegistry) resolve(boardID, href string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.boards[boardID]
+	if ok && b.MovedFrom != "" && sameBoardURL(b.MovedFrom, href) {
+		return b.URL
+	}
+	return href
+}
+
+// fetched はsubject.txtを取得できた板URLを記録する
+func (r *boardRegistry) fetched(boardID, boardURL string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := r.boards[boardID]
+	b.URL = boardURL
+	b.LastFetched = time.Now().Format(time.RFC3339)
+	r.boards[boardID] = b
+}
+
+// moved は板の移転を記録する
+func (r *boardRegistry) moved(boardID, from, to string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := r.boards[boardID]
+	b.URL = to
+	b.MovedFrom = from
+	b.MovedAt = time.Now().Format(time.RFC3339)
+	r.boards[boardID] = b
+}
+
+// save はレジストリをファイルに保存する
+func (r *boardRegistry) save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := json.MarshalIndent(r.boards, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "could not marshal: %s", r.path)
+	}
+	return cmd.WriteOutFile(r.path, b)
+}
+
+// 2つの板URLがスキームと末尾のスラッシュを除いて同じならtrueを返す
+func sameBoardURL(a, b string) bool {
+	normalize := func(s string) string {
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "https://"), "http://")
+		return strings.TrimSuffix(s, "/")
+	}
+	return normalize(a) == normalize(b)
+}
+
+var (
+	// 移転案内ページのJavaScriptによる移転先
+	movedScript = regexp.MustCompile(`(?i)window\.location\.href\s*=\s*["']([^"']+)["']`)
+	// 移転案内ページのmeta refreshによる移転先
+	movedRefresh = regexp.MustCompile(`(?i)<meta[^>]+http-equiv=["']?refresh["']?[^>]+url=([^"'>\s]+)`)
+)
+
+// relocatedBoardURL はsubject.txtの代わりに返された移転案内ページから移転先の板URLを返す。
+// 移転案内ページでない場合や移転先が分からない場合、移転先が板URLboardURLと同じサイトのドメインでない場合は空文字を返す。
+func relocatedBoardURL(body []byte, boardURL, boardID string) string {
+	if !bbs.LooksLikeHTML(body) {
+		return ""
+	}
+	for _, re := range []*regexp.Regexp{movedScript, movedRefresh} {
+		if m := re.FindSubmatch(body); m != nil {
+			u, err := url.Parse(string(m[1]))
+			if err != nil || u.Host == "" || !sameSiteDomain(u.Host, hostOf(boardURL)) {
+				continue
+			}
+			return boardURLOn(u, boardID)
+		}
+	}
+	return ""
+}
+
+// redirectedBoardURL はsubject.txtがリダイレクトされた場合にリダイレクト先の板URLを返す。
+// リダイレクトされていない場合やリダイレクト先が板URLboardURLと同じサイトのドメインでない場合は空文字を返す。
+func redirectedBoardURL(requested, final, boardURL, boardID string) string {
+	if final == "" || final == requested {
+		return ""
+	}
+	u, err := url.Parse(final)
+	if err != nil || u.Host == "" || !sameSiteDomain(u.Host, hostOf(boardURL)) {
+		return ""
+	}
+	return boardURLOn(u, boardID)
+}
+
+// 2つのホストのドメイン(末尾の2つのラベル。例: 5ch.net)が同じならtrueを返す
+func sameSiteDomain(a, b string) bool {
+	domain := func(host string) string {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		labels := strings.Split(strings.ToLower(host), ".")
+		if len(labels) > 2 {
+			labels = labels[len(labels)-2:]
+		}
+		return strings.Join(labels, ".")
+	}
+	return domain(a) == domain(b)
+}
+
+// uのホストにある板IDの板URLを返す
+func boardURLOn(u *url.URL, boardID string) string {
+	scheme := u.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return scheme + "://" + u.Host + path.Join("/", boardID) + "/"
+}
@@ -0,0 +1,46 @@
+package source_test
+
+import (
+	"testing"
+
+	"github.com/ohnishi/nahaha/backend/source"
+)
+
+func TestRelocatedBoardURL(t *testing.T) {
+	const boardURL = "https://hayabusa9.5ch.net/news/"
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "script",
+			body: `<html><script>window.location.href="https://asahi.5ch.net/test/read.cgi/news/";</script></html>`,
+			want: "https://asahi.5ch.net/news/",
+		},
+		{
+			name: "meta refresh",
+			body: `<html><head><meta http-equiv="refresh" content="0;URL=https://asahi.5ch.net/news/"></head></html>`,
+			want: "https://asahi.5ch.net/news/",
+		},
+		{
+			name: "other site",
+			body: `<html><script>window.location.href="https://example.com/news/";</script></html>`,
+		},
+		{
+			name: "look-alike domain",
+			body: `<html><script>window.location.href="https://asahi.5ch.net.example.com/news/";</script></html>`,
+		},
+		{
+			name: "not html",
+			body: "1604124000.dat<>window.location.href=\"https://asahi.5ch.net/news/\" (10)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := source.ExportRelocatedBoardURL([]byte(tt.body), boardURL, "news"); got != tt.want {
+				t.Errorf("relocatedBoardURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+	"github.com/ohnishi/nahaha/backend/common/command"
+	"github.com/ohnishi/nahaha/backend/common/core"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+func init() {
+	Register(&fiveChDatSource{})
+}
+
+// fiveChDatSource は話題のスレッドの本文(.dat)をニュースソースとして扱う
+type fiveChDatSource struct {
+	date            string
+	trends          string
+	keywords        []string
+	maxThreads      int
+	concurrency     int
+	hostConcurrency int
+}
+
+func (*fiveChDatSource) Name() string { return "5ch-dat" }
+
+func (*fiveChDatSource) Description() string { return "5ch thread posts (.dat)" }
+
+func (s *fiveChDatSource) SetFetchFlags(f *pflag.FlagSet) {
+	f.StringVar(&s.date, "date", "", "date of the 5ch fetch data in 'YYYYmmdd' from which threads are selected (default today)")
+	f.StringVar(&s.trends, "trends", "", "trends json whose ranked words select threads to fetch")
+	f.StringSliceVar(&s.keywords, "keyword", nil, "word in thread titles which selects threads to fetch")
+	f.IntVar(&s.maxThreads, "max-threads", 100, "max number of threads fetched in a run")
+	f.IntVar(&s.concurrency, "concurrency", 4, "max number of .dat fetched concurrently")
+	f.IntVar(&s.hostConcurrency, "host-concurrency", 1, "max number of .dat fetched concurrently from the same host")
+}
+
+// Fetch はopts.Srcの5chのfetchデータからキーワードを含むスレッドを選び、
+// .datを取得してレスをJSONLで opts.Dest/YYYYMMDD/<板ID>/<スレッドキー>.jsonl に保存する
+func (s *fiveChDatSource) Fetch(ctx context.Context, opts FetchOptions) error {
+	date := opts.now()
+	if s.date != "" {
+		d, err := core.ParseLocal(command.DatesFlagFormat, s.date)
+		if err != nil {
+			return command.NewFlagErrorf("invalid date: %s", s.date)
+		}
+		date = d
+	}
+
+	keywords := s.keywords
+	if s.trends != "" {
+		var content cmd.Content
+		if err := cmd.ReadFileJSON(s.trends, &content); err != nil {
+			return errors.Wrapf(err, "failed to read trends: %s", s.trends)
+		}
+		for _, item := range content.Items {
+			keywords = append(keywords, item.Word)
+		}
+	}
+	if len(keywords) == 0 {
+		return command.NewFlagErrorf("either --trends or --keyword is required")
+	}
+
+	dateStr := date.Format("20060102")
+	threadMap, err := toThreadMap(ctx, fiveCh, opts.Src, dateStr)
+	if err != nil {
+		return err
+	}
+	threads := selectThreads(threadMap, keywords, s.maxThreads)
+
+	out := filepath.Join(opts.Dest, dateStr)
+	m := &manifest{}
+	pool := newFetchPool(s.concurrency, s.hostConcurrency)
+	pool.each(len(threads), func(i int) string {
+		return hostOf(threads[i].URL)
+	}, func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+		// .datの取得に失敗しても処理は止めずに、マニフェストに記録した結果から後で確認する
+		_ = fetchDat(ctx, opts.Client, m, threads[i].URL, out)
+	})
+	if err := m.write(filepath.Join(out, manifestFileName)); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "fetch 5ch dat was canceled")
+	}
+	return nil
+}
+
+// タイトルにキーワードを含むスレッドを最終確認時刻が新しい順に最大max件返す
+func selectThreads(m map[string]newsArticleJSON, keywords []string, max int) []newsArticleJSON {
+	var threads []newsArticleJSON
+	for _, t := range m {
+		title := strings.ToLower(t.Title)
+		for _, k := range keywords {
+			if k != "" && strings.Contains(title, strings.ToLower(k)) {
+				threads = append(threads, t)
+				break
+			}
+		}
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		if threads[i].LastSeen != threads[j].LastSeen {
+			return threads[i].LastSeen > threads[j].LastSeen
+		}
+		return threads[i].URL < threads[j].URL
+	})
+	if max > 0 && len(threads) > max {
+		threads = threads[:max]
+	}
+	return threads
+}
+
+// スレッドURLから.datを取得してレスをJSONLで保存する
+func fetchDat(ctx context.Context, c *fetch.Client, m *manifest, threadURL, out string) error {
+	datURL, boardID, threadKey, err := toDatURL(threadURL)
+	if err != nil {
+		return err
+	}
+	return m.fetch(ctx, c, boardID+"/"+threadKey, datURL, func(res *fetch.Response) error {
+		return saveDat(res.Body, threadURL, filepath.Join(out, boardID, threadKey+".jsonl"))
+	})
+}
+
+// .datをパースしてレスをJSONLでpathに保存する
+// パースできない場合はエラーを返し、前回保存したファイルを残す
+func saveDat(b []byte, threadURL, path string) error {
+	posts, err := parseDat(b, threadURL)
+	if err != nil {
+		return err
+	}
+
+	f, err := cmd.CreateOutFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, p := range posts {
+		if err := cmd.AppendOutFile(f, p); err != nil {
+			return err
+		}
+	}
+	return f.Commit()
+}
+
+// 5chスレッドURL(https://<host>/test/read.cgi/<板ID>/<スレッドキー>/)から.datのURLを生成して返す
+func toDatURL(threadURL string) (string, string, string, error) {
+	u, err := url.Parse(threadURL)
+	if err != nil {
+		return "", "", "", errors.Wrapf(err, "failed parse url : %s", threadURL)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 4 || parts[0] != "test" || parts[1] != "read.cgi" {
+		return "", "", "", errors.Errorf("unexpected thread URL : %s", threadURL)
+	}
+	boardID, threadKey := parts[2], parts[3]
+	u.Path = fmt.Sprintf("/%s/dat/%s.dat", boardID, threadKey)
+	return u.String(), boardID, threadKey, nil
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// Shift_JISの.datをパースしてレスの一覧を返す
+// .datの各行は `名前<>メール<>日付 ID<>本文<>スレッドタイトル` の形式で、タイトルは1行目のみ
+// HTMLのエラーページなど、レスが1件もパースできない場合はエラーを返す
+func parseDat(b []byte, threadURL string) ([]cmd.Post, error) {
+	if bbs.LooksLikeHTML(b) {
+		return nil, errors.Errorf("dat is HTML: %s", threadURL)
+	}
+	r := transform.NewReader(bytes.NewReader(b), japanese.ShiftJIS.NewDecoder())
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var posts []cmd.Post
+	for n := 1; scanner.Scan(); n++ {
+		records := strings.Split(scanner.Text(), "<>")
+		if len(records) < 4 {
+			fmt.Printf("unexpected dat line. url=%s number=%d\n", threadURL, n)
+			continue
+		}
+		date, id := splitDatDate(records[2])
+		posts = append(posts, cmd.Post{
+			ThreadURL: threadURL,
+			Number:    n,
+			Name:      toPlainText(records[0]),
+			Mail:      records[1],
+			Date:      date,
+			ID:        id,
+			Body:      toPlainText(strings.ReplaceAll(records[3], "<br>", "\n")),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read dat: %s", threadURL)
+	}
+	if len(posts) == 0 {
+		return nil, errors.Errorf("no posts in dat: %s", threadURL)
+	}
+	return posts, nil
+}
+
+// .datの日付欄(例: 2020/10/31(土) 15:00:00.12 ID:abcdefgh0)を日付とIDに分けて返す
+// 日付がパースできた場合はRFC3339に変換し、できない場合は元の文字列を返す
+func splitDatDate(s string) (string, string) {
+	date, id := s, ""
+	if i := strings.Index(s, " ID:"); i >= 0 {
+		date = s[:i]
+		if fields := strings.Fields(s[i+len(" ID:"):]); len(fields) > 0 {
+			id = fields[0]
+		}
+	}
+	date = strings.TrimSpace(date)
+
+	// 曜日の括弧を除去してからパースする
+	plain := date
+	if i := strings.Index(plain, "("); i >= 0 {
+		if j := strings.Index(plain[i:], ")"); j >= 0 {
+			plain = plain[:i] + plain[i+j+1:]
+		}
+	}
+	// 秒の小数部はレイアウトに無くてもパースできる
+	if t, err := core.ParseLocal("2006/01/02 15:04:05", plain); err == nil {
+		return t.Format(time.RFC3339), id
+	}
+	return date, id
+}
+
+// HTMLタグを除去して実体参照を戻したテキストを返す
+func toPlainText(s string) string {
+	return strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(s, "")))
+}
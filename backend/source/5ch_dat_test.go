@@ -0,0 +1,95 @@
+package source_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/source"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestSplitDatDate(t *testing.T) {
+	rfc3339 := func(year int, month time.Month, day, hour, min, sec int) string {
+		return time.Date(year, month, day, hour, min, sec, 0, time.Local).Format(time.RFC3339)
+	}
+	tests := []struct {
+		in       string
+		wantDate string
+		wantID   string
+	}{
+		{"2020/10/31(土) 15:00:00.12 ID:abcdefgh0", rfc3339(2020, 10, 31, 15, 0, 0), "abcdefgh0"},
+		{"2020/10/31(土) 15:00:00 ID:abcdefgh0 BE:123-2BP(1000)", rfc3339(2020, 10, 31, 15, 0, 0), "abcdefgh0"},
+		{"2020/10/31(土) 15:00:00.12", rfc3339(2020, 10, 31, 15, 0, 0), ""},
+		{"2020/01/02 03:04:05 ID:x", rfc3339(2020, 1, 2, 3, 4, 5), "x"},
+		{"あぼーん", "あぼーん", ""},
+		{"Over 1000 Thread ID:???", "Over 1000 Thread", "???"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		date, id := source.ExportSplitDatDate(tt.in)
+		if date != tt.wantDate || id != tt.wantID {
+			t.Errorf("splitDatDate(%q) = (%q, %q), want (%q, %q)", tt.in, date, id, tt.wantDate, tt.wantID)
+		}
+	}
+}
+
+func TestParseDat(t *testing.T) {
+	const threadURL = "https://hayabusa9.5ch.net/test/read.cgi/news/1604124000/"
+	date := time.Date(2020, 10, 31, 15, 0, 0, 0, time.Local).Format(time.RFC3339)
+
+	tests := []struct {
+		name    string
+		dat     string
+		want    []cmd.Post
+		wantErr bool
+	}{
+		{
+			name: "posts",
+			dat: "名無しさん<>sage<>2020/10/31(土) 15:00:00.12 ID:abc<> 1行目<br>2行目 <>スレタイ\n" +
+				"<b>コテ</b><><>2020/10/31(土) 15:00:00.34 ID:def<> &gt;&gt;1 <a href=\"../test/read.cgi/news/1604124000/1\">リンク</a> <>\n",
+			want: []cmd.Post{
+				{ThreadURL: threadURL, Number: 1, Name: "名無しさん", Mail: "sage", Date: date, ID: "abc", Body: "1行目\n2行目"},
+				{ThreadURL: threadURL, Number: 2, Name: "コテ", Mail: "", Date: date, ID: "def", Body: ">>1 リンク"},
+			},
+		},
+		{
+			name: "broken line keeps post number",
+			dat:  "broken line\n名無しさん<><>2020/10/31(土) 15:00:00.12 ID:abc<>本文<>\n",
+			want: []cmd.Post{
+				{ThreadURL: threadURL, Number: 2, Name: "名無しさん", Date: date, ID: "abc", Body: "本文"},
+			},
+		},
+		{
+			name:    "empty",
+			dat:     "",
+			wantErr: true,
+		},
+		{
+			name:    "no posts",
+			dat:     "broken line\n",
+			wantErr: true,
+		},
+		{
+			name:    "html error page",
+			dat:     "<html><body>名無しさん<>sage<>2020/10/31<>本文<></body></html>\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(tt.dat))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := source.ExportParseDat(b, threadURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package source
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+	"github.com/ohnishi/nahaha/backend/common/core"
+	"github.com/pkg/errors"
+)
+
+// boardFilter はfetch対象の5chの板を絞り込む設定を表す
+type boardFilter struct {
+	// IncludeCategories が空でなければ、いずれかのカテゴリに属する板のみを対象にする
+	IncludeCategories []string `json:"include_categories"`
+	// ExcludeCategories のカテゴリに属する板は対象外にする
+	ExcludeCategories []string `json:"exclude_categories"`
+	// Boards が空でなければ、いずれかの板IDの板のみを対象にする
+	Boards []string `json:"boards"`
+	// ExcludeURLs は板一覧にある板以外へのリンクURL
+	ExcludeURLs []string `json:"exclude_urls"`
+}
+
+// 設定ファイルの有無に関わらず使う板の絞り込み設定
+var defaultBoardFilter = boardFilter{
+	ExcludeURLs: []string{
+		"https://www.5ch.net/",             // 5chの入り口
+		"https://www.5ch.net/kakolog.html", // 過去ログ倉庫
+		"https://newsnavi.5ch.net/",        // 2NN+
+		"https://info.5ch.net/",            // 5ch総合案内
+		"https://search.5ch.net/",          // 検索[ベータ版]
+		"https://dig.5ch.net/",             // 超スレタイ検索
+		"https://stat.5ch.net/",            // 5ch投稿数
+		"https://o.5ch.net/",               // お絵描き観測所
+		"https://i.5ch.net/",               // スマホメニュー
+		"https://be.5ch.net/",              // be.5ch.net
+		"https://premium.5ch.net/",         // 5chプレミアム浪人
+		"https://info.5ch.net/wiki/",       // 5chプロジェクト
+		"https://matsuri.5ch.net/maru/",    // ●
+		"https://info.5ch.net/?curid=2078", // 書き込む前に
+		"mailto:admin@5ch.net",             // メール
+		"https://www.bbspink.com/",         // Pinkちゃんねる
+		"https://ronin.bbspink.com/",       // 浪人
+		"https://info.5ch.net/rank/",       // いろいろランク
+	},
+}
+
+// JSONファイルから板の絞り込み設定を読み込み、デフォルトの設定に追加して返す。
+// ファイルが存在しない場合はデフォルトの設定を返す
+func readBoardFilter(path string) (boardFilter, error) {
+	var filter boardFilter
+	filter.merge(defaultBoardFilter)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return filter, nil
+		}
+		return filter, errors.Wrapf(err, "failed to read file: %s", path)
+	}
+	var config boardFilter
+	if err := json.Unmarshal(content, &config); err != nil {
+		return filter, errors.Wrapf(err, "failed to unmarshal json: %s", path)
+	}
+	filter.merge(config)
+	return filter, nil
+}
+
+// merge は設定ファイルやフラグで指定された絞り込み条件を追加する
+func (f *boardFilter) merge(f2 boardFilter) {
+	f.IncludeCategories = append(f.IncludeCategories, f2.IncludeCategories...)
+	f.ExcludeCategories = append(f.ExcludeCategories, f2.ExcludeCategories...)
+	f.Boards = append(f.Boards, f2.Boards...)
+	f.ExcludeURLs = append(f.ExcludeURLs, f2.ExcludeURLs...)
+}
+
+// key は絞り込み条件ごとにhealth checkの履歴を分けるためのキーを返す。
+// 板一覧にある板以外へのリンクの除外は件数の比較に影響しないので含めない。絞り込んでいない場合は空文字列を返す
+func (f boardFilter) key() string {
+	var parts []string
+	add := func(name string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		vs := append([]string(nil), values...)
+		sort.Strings(vs)
+		parts = append(parts, name+"="+strings.Join(vs, ","))
+	}
+	add("include_categories", f.IncludeCategories)
+	add("exclude_categories", f.ExcludeCategories)
+	add("boards", f.Boards)
+	return strings.Join(parts, " ")
+}
+
+// match は板一覧のリンクがfetch対象の板であればtrueを返す
+func (f boardFilter) match(l link) bool {
+	if core.NewStringSet(f.ExcludeURLs...).Include(l.href) {
+		return false
+	}
+	if len(f.IncludeCategories) > 0 && !core.NewStringSet(f.IncludeCategories...).Include(l.category) {
+		return false
+	}
+	if core.NewStringSet(f.ExcludeCategories...).Include(l.category) {
+		return false
+	}
+	if len(f.Boards) > 0 {
+		boardID, err := bbs.Nichannel.BoardID(l.href)
+		if err != nil || !core.NewStringSet(f.Boards...).Include(boardID) {
+			return false
+		}
+	}
+	return true
+}
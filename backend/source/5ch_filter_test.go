@@ -0,0 +1,38 @@
+package source_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ohnishi/nahaha/backend/source"
+)
+
+func TestReadBoardFilter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "5ch.json")
+	if err := ioutil.WriteFile(path, []byte(`{"exclude_categories":["チャット"],"exclude_urls":["https://example.5ch.net/"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defaults, err := source.ExportReadBoardFilter(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := source.ExportReadBoardFilter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	excluded := make(map[string]bool)
+	for _, u := range filter.ExcludeURLs {
+		excluded[u] = true
+	}
+	for _, u := range append(defaults.ExcludeURLs, "https://example.5ch.net/") {
+		if !excluded[u] {
+			t.Errorf("ExcludeURLs does not include %s: %v", u, filter.ExcludeURLs)
+		}
+	}
+	if len(filter.ExcludeCategories) != 1 || filter.ExcludeCategories[0] != "チャット" {
+		t.Errorf("ExcludeCategories = %v, want [チャット]", filter.ExcludeCategories)
+	}
+}
@@ -0,0 +1,21 @@
+package source
+
+import (
+	"context"
+	"time"
+)
+
+// 5ch スレッドタイトルから除外するワード
+var replaceThreadTitleWords = []string{
+	"&#169;2ch.net",
+	"&copy;2ch.net",
+	"&#169;bbspink.com",
+	"&copy;bbspink.com",
+	"[無断転載禁止]",
+	"[転載禁止]",
+}
+
+// Transform はfetchしたsubject.txtからターゲット日に作成された5chスレッドを抽出する
+func (fiveChSource) Transform(ctx context.Context, src, dest string, date time.Time) error {
+	return transformBBS(ctx, fiveCh, src, dest, date)
+}
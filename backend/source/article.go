@@ -0,0 +1,134 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/command"
+	"github.com/ohnishi/nahaha/backend/common/core"
+	"github.com/ohnishi/nahaha/backend/common/extract"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	Register(&articleSource{})
+}
+
+// articleSource はtransformしたニュース記事のページを取得して本文を抽出する
+type articleSource struct {
+	date            string
+	files           []string
+	concurrency     int
+	hostConcurrency int
+}
+
+func (*articleSource) Name() string { return "article" }
+
+func (*articleSource) Description() string { return "main text of news articles" }
+
+func (s *articleSource) SetFetchFlags(f *pflag.FlagSet) {
+	f.StringVar(&s.date, "date", "", "date of the transformed articles in 'YYYYmmdd' (default today)")
+	f.StringSliceVar(&s.files, "file", []string{"rss.jsonl"}, "transformed article file whose pages are fetched")
+	f.IntVar(&s.concurrency, "concurrency", 8, "max number of article pages fetched concurrently")
+	f.IntVar(&s.hostConcurrency, "host-concurrency", 2, "max number of article pages fetched concurrently from the same host")
+}
+
+// Fetch はopts.Src/YYYYMMDD/<file>の記事ページを取得して本文を抽出し、
+// 記事JSONLと並べて opts.Dest/YYYYMMDD/<file>の拡張子を.body.jsonlにしたファイル に保存する
+func (s *articleSource) Fetch(ctx context.Context, opts FetchOptions) error {
+	date := opts.now()
+	if s.date != "" {
+		d, err := core.ParseLocal(command.DatesFlagFormat, s.date)
+		if err != nil {
+			return command.NewFlagErrorf("invalid date: %s", s.date)
+		}
+		date = d
+	}
+	dateStr := date.Format("20060102")
+
+	m := &manifest{}
+	for _, file := range s.files {
+		if err := s.fetchBodies(ctx, opts, m, dateStr, file); err != nil {
+			return err
+		}
+	}
+	if err := m.write(filepath.Join(opts.Dest, dateStr, manifestFileName)); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "fetch article was canceled")
+	}
+	return nil
+}
+
+// 記事JSONLの記事ページを取得して本文を保存する
+func (s *articleSource) fetchBodies(ctx context.Context, opts FetchOptions, m *manifest, dateStr, file string) error {
+	var articles []newsArticleJSON
+	path := filepath.Join(opts.Src, dateStr, file)
+	if err := readArticleJSONL(path, func(a newsArticleJSON) { articles = append(articles, a) }); err != nil {
+		return err
+	}
+
+	bodies := make([]*cmd.ArticleBody, len(articles))
+	pool := newFetchPool(s.concurrency, s.hostConcurrency)
+	pool.each(len(articles), func(i int) string {
+		return hostOf(articles[i].URL)
+	}, func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+		// 記事ページの取得に失敗しても処理は止めずに、マニフェストに記録した結果から後で確認する
+		_ = m.fetch(ctx, opts.Client, articles[i].URL, articles[i].URL, func(res *fetch.Response) error {
+			text, err := extract.MainText(res.Body, res.Header.Get("Content-Type"))
+			if err != nil {
+				return errors.Wrapf(err, "failed to extract main text: %s", articles[i].URL)
+			}
+			if text != "" {
+				bodies[i] = &cmd.ArticleBody{URL: articles[i].URL, Text: text}
+			}
+			return nil
+		})
+	})
+	if ctx.Err() != nil {
+		// 中断した場合は途中までの本文で既存のファイルを置き換えない
+		return nil
+	}
+
+	f, err := cmd.CreateOutFile(filepath.Join(opts.Dest, dateStr, cmd.ArticleBodyFileName(file)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, b := range bodies {
+		if b == nil {
+			continue
+		}
+		if err := cmd.AppendOutFile(f, b); err != nil {
+			return err
+		}
+	}
+	return f.Commit()
+}
+
+// 記事JSONLファイルを1行ずつデコードしてfnに渡す
+func readArticleJSONL(path string, fn func(a newsArticleJSON)) error {
+	r, err := cmd.OpenFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open file: %s", path)
+	}
+	defer r.Close()
+
+	d := json.NewDecoder(r)
+	for d.More() {
+		var a newsArticleJSON
+		if err := d.Decode(&a); err != nil {
+			return errors.Wrapf(err, "could not unmarshal: %s", path)
+		}
+		fn(a)
+	}
+	return nil
+}
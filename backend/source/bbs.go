@@ -0,0 +1,184 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+	"github.com/ohnishi/nahaha/backend/common/core"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+)
+
+// bbsSite はsubject.txt形式の掲示板サイトを表す
+type bbsSite struct {
+	// name はソース名。ログと変換後のファイル名に使う
+	name string
+	// layout は板URLとsubject.txt、スレッドURLの構成
+	layout bbs.Layout
+	// encoding はsubject.txtの文字コード。nilの場合はUTF-8
+	encoding encoding.Encoding
+	// removeTitleWords はスレッドタイトルから除外するワード
+	removeTitleWords []string
+}
+
+// fetchBBS はlinksの板のsubject.txtを取得して、板の情報とともに opts.Dest/YYYYMMDD/hhmm に保存する
+// 各subject.txtの取得結果はmに追加してスナップショットのマニフェストに書き出す
+// 板と取得できたsubject.txtの件数が同じ絞り込み条件filterの直近のfetchより激減した場合はエラーを返す
+func fetchBBS(ctx context.Context, opts FetchOptions, site bbsSite, m *manifest, reg *boardRegistry, links []link, filter string, pool *fetchPool) error {
+	fetchDir := snapshotDir(opts.Dest, opts.now())
+	boards := toBoards(ctx, opts, site, m, reg, links, fetchDir, pool)
+	if reg != nil {
+		if err := reg.save(); err != nil {
+			return err
+		}
+	}
+	if err := m.write(filepath.Join(fetchDir, manifestFileName)); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.Wrapf(err, "fetch %s was canceled", site.name)
+	}
+
+	// 板一覧の構造が変わって板が激減した場合は、板の情報を保存せずにtransformの対象から外す
+	h := newHealthCheck(site.name)
+	h.filter = filter
+	h.count("boards", len(links))
+	h.count("subjects", len(boards))
+	if err := h.check(opts); err != nil {
+		return err
+	}
+	return saveBoards(fetchDir, opts.now(), boards)
+}
+
+// スクレイピングで取得した板URLの一覧から板の情報を取得して返す
+// subject.txtはpoolの同時実行数の範囲で並行に取得し、結果は板一覧の順序で返す
+// 各subject.txtの取得結果はmに記録し、regがnilでなければ板の移転をregに記録する
+func toBoards(ctx context.Context, opts FetchOptions, site bbsSite, m *manifest, reg *boardRegistry, links []link, out string, pool *fetchPool) []cmd.Board {
+	linkSet := core.StringSet{}
+	var targets []link
+	for _, l := range links {
+		if linkSet.Include(l.href) {
+			//たまに重複したリンクURLがあるので重複チェックする
+			continue
+		}
+		linkSet.Add(l.href)
+		targets = append(targets, l)
+	}
+
+	results := make([]*cmd.Board, len(targets))
+	pool.each(len(targets), func(i int) string {
+		return hostOf(targets[i].href)
+	}, func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+		l := targets[i]
+		boardID, boardURL, err := getSubject(ctx, opts, site, m, reg, l.href, out)
+		if err != nil {
+			// subject.txtの取得に失敗しても処理は止めずに、マニフェストに記録した結果から後で確認する
+			return
+		}
+
+		// スレッドURLは移転先の板URLから生成する
+		results[i] = &cmd.Board{ID: boardID, Name: l.text, URL: boardURL, Category: l.category}
+	})
+
+	var boards []cmd.Board
+	for _, b := range results {
+		if b != nil {
+			boards = append(boards, *b)
+		}
+	}
+	return boards
+}
+
+// 移転案内を受け取った時に移転先を辿る最大回数
+const maxBoardMoves = 3
+
+// 板URLからsubject.txtを取得して保存する
+// regがnilでなければ、板が移転していれば移転先から取得して、移転先のsubject.txtを保存できた場合に移転先をregに記録する。
+// 取得に使った板IDと板URLを返す
+func getSubject(ctx context.Context, opts FetchOptions, site bbsSite, m *manifest, reg *boardRegistry, href, out string) (string, string, error) {
+	boardID, err := site.layout.BoardID(href)
+	if err != nil {
+		return boardID, "", err
+	}
+	boardURL := href
+	if reg != nil {
+		boardURL = reg.resolve(boardID, href)
+	}
+	movedFrom := boardURL
+
+	for moves := 0; ; moves++ {
+		subjectURL, err := site.layout.SubjectURL(boardURL)
+		if err != nil {
+			return boardID, boardURL, err
+		}
+
+		var movedTo string
+		err = m.fetch(ctx, opts.Client, boardID, subjectURL, func(res *fetch.Response) error {
+			if reg != nil {
+				if to := relocatedBoardURL(res.Body, boardURL, boardID); to != "" && !sameBoardURL(to, boardURL) {
+					movedTo = to
+					return errors.Errorf("board moved to %s : %s", to, subjectURL)
+				}
+			}
+			// HTMLのエラーページなどで前回のsubject.txtを置き換えないよう、検証してから保存する
+			path := filepath.Join(out, filepath.FromSlash(boardID))
+			if err := opts.saveValidated(subjectValidator, res.Header.Get("Content-Type"), res.Body, path); err != nil {
+				return errors.WithMessage(err, subjectURL)
+			}
+			if reg != nil {
+				if to := redirectedBoardURL(subjectURL, res.URL, boardURL, boardID); to != "" {
+					boardURL = to
+				}
+			}
+			return nil
+		})
+		if movedTo != "" && moves < maxBoardMoves {
+			// 移転先のsubject.txtを検証できるまでは移転を記録しない
+			boardURL = movedTo
+			continue
+		}
+		if err != nil {
+			return boardID, boardURL, err
+		}
+		if reg != nil {
+			if !sameBoardURL(movedFrom, boardURL) {
+				reg.moved(boardID, movedFrom, boardURL)
+			}
+			reg.fetched(boardID, boardURL)
+		}
+		return boardID, boardURL, nil
+	}
+}
+
+// 板URLと板名を保存する
+func saveBoards(out string, date time.Time, boards []cmd.Board) error {
+	if len(boards) == 0 {
+		return nil
+	}
+
+	fi := cmd.FetchInfo{
+		Date:   date.Format(time.RFC3339),
+		Boards: boards,
+	}
+
+	path := filepath.Join(out, "fetch_info.json")
+	f, err := cmd.CreateOutFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = json.NewEncoder(f).Encode(fi)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write json : path=%s, value=%v", path, fi)
+	}
+	return f.Commit()
+}
@@ -0,0 +1,162 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// transformBBS fetchしたsubject.txtからターゲット日に作成されたスレッドを抽出して <dest>/YYYYMMDD/<ソース名>.jsonl に保存する
+func transformBBS(ctx context.Context, site bbsSite, src, dest string, date time.Time) error {
+	dateStr := date.Format("20060102")
+	threadMap, err := toThreadMap(ctx, site, src, dateStr)
+	if err != nil {
+		return err
+	}
+
+	return writeArticleJSOL(dest, dateStr, site.name+".jsonl", threadMap)
+}
+
+// ターゲット日に作成されたスレッド情報を返す
+// ターゲット日の全スナップショットをマージし、スレッドごとに初出・最終確認時刻を記録する
+// マニフェストから取得に失敗した板を集計して出力する
+func toThreadMap(ctx context.Context, site bbsSite, src string, dateStr string) (map[string]newsArticleJSON, error) {
+	snapshots, err := listSnapshots(src, dateStr)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]newsArticleJSON)
+	missing := newMissingData()
+	merged := 0
+	for _, ss := range snapshots {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.Wrapf(err, "transform %s was canceled", site.name)
+		}
+		entries, err := readManifest(ss.dir)
+		if err != nil {
+			return nil, err
+		}
+		missing.add(entries, nil)
+
+		fetchInfo, err := readFetchInfo(ss.dir)
+		if err != nil {
+			// 中断されたスナップショットがあっても他のスナップショットは処理する
+			fmt.Println("failed to read fetch info.", zap.String("dir", ss.dir), zap.Error(err))
+			continue
+		}
+		if err := mergeThreads(m, site, ss, fetchInfo, dateStr); err != nil {
+			return nil, err
+		}
+		merged++
+	}
+	missing.report(site.name, dateStr)
+	if merged == 0 {
+		return nil, errors.Errorf("no %s snapshot found: %s", site.name, filepath.Join(src, dateStr))
+	}
+	return m, nil
+}
+
+// スナップショットのsubject.txtからターゲット日に作成されたスレッド情報を抽出してmにマージする
+func mergeThreads(m map[string]newsArticleJSON, site bbsSite, ss snapshot, fetchInfo cmd.FetchInfo, dateStr string) error {
+	for _, b := range fetchInfo.Boards {
+		subjectTextPath := filepath.Join(ss.dir, filepath.FromSlash(b.ID))
+
+		file, err := cmd.OpenFile(subjectTextPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read file: %s", subjectTextPath)
+		}
+		err = bbs.ReadSubject(file, site.encoding, func(line string, t bbs.Thread, err error) {
+			if err != nil {
+				fmt.Println("unexpected string", zap.String("string", line), zap.Error(err))
+				return
+			}
+			if dateStr != t.CreatedAt.Format("20060102") {
+				return
+			}
+
+			url, err := site.layout.ThreadURL(b.URL, t.Key)
+			if err != nil {
+				fmt.Println("failed to generate thread URL", zap.String("url", b.URL), zap.String("id", b.ID), zap.String("threadKey", t.Key), zap.Error(err))
+				return
+			}
+
+			threadTitle := site.threadTitle(t.Title)
+			if len(threadTitle) > 512 {
+				//512文字以上のタイトルならDBに挿入不可能かつ、画面表示も難しいためスキップ
+				return
+			}
+
+			json, ok := m[url]
+			if !ok {
+				json = newsArticleJSON{
+					Date:     t.CreatedAt.Format(time.RFC3339),
+					URL:      url,
+					Name:     b.Name,
+					Title:    threadTitle,
+					Category: b.Category,
+				}
+			}
+			if last, err := time.Parse(time.RFC3339, json.LastSeen); err != nil || !ss.time.Before(last) {
+				// レス数と勢いは最新のスナップショットの値を使う
+				json.ResCount = t.ResCount
+				json.Momentum = toMomentum(t.ResCount, t.CreatedAt, ss.time)
+			}
+			json.seen(ss.time)
+			m[url] = json
+		})
+		if err != nil {
+			file.Close()
+			return errors.Wrapf(err, "failed to read file: %s", subjectTextPath)
+		}
+
+		err = file.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to close file: %s", subjectTextPath)
+		}
+	}
+	return nil
+}
+
+// threadTitle はsubject.txtのスレッドタイトルから除外するワードを取り除いて返す
+func (s bbsSite) threadTitle(title string) string {
+	for _, w := range s.removeTitleWords {
+		title = strings.Replace(title, w, "", 1)
+	}
+	return strings.TrimSpace(title)
+}
+
+// fetchした板の名前一覧情報を返す
+func readFetchInfo(dir string) (cmd.FetchInfo, error) {
+	var fetchInfo cmd.FetchInfo
+
+	jsonPath := filepath.Join(dir, "fetch_info.json")
+	content, err := cmd.ReadFile(jsonPath)
+	if err != nil {
+		return fetchInfo, errors.Wrapf(err, "failed to read file: %s", jsonPath)
+	}
+
+	err = json.Unmarshal(content, &fetchInfo)
+	if err != nil {
+		return fetchInfo, errors.Wrapf(err, "failed to unmarshal json: %s", jsonPath)
+	}
+	return fetchInfo, nil
+}
+
+// スレッド作成からfetch時点までの1時間あたりのレス数を勢いとして返す
+func toMomentum(resCount int, createdAt, fetchedAt time.Time) float64 {
+	elapsed := fetchedAt.Sub(createdAt).Hours()
+	// 作成直後のスレッドの勢いが極端に大きくならないよう経過時間は最低1分とする
+	if elapsed < 1.0/60 {
+		elapsed = 1.0 / 60
+	}
+	return float64(resCount) / elapsed
+}
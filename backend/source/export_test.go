@@ -0,0 +1,36 @@
+package source
+
+import "time"
+
+var (
+	ExportParseDat          = parseDat
+	ExportSplitDatDate      = splitDatDate
+	ExportRelocatedBoardURL = relocatedBoardURL
+	ExportReadBoardFilter   = readBoardFilter
+)
+
+// ExportListSnapshots はターゲット日のスナップショットのディレクトリと時刻を時刻順に返す
+func ExportListSnapshots(src, dateStr string) ([]string, []time.Time, error) {
+	snapshots, err := listSnapshots(src, dateStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	dirs := make([]string, len(snapshots))
+	times := make([]time.Time, len(snapshots))
+	for i, ss := range snapshots {
+		dirs[i], times[i] = ss.dir, ss.time
+	}
+	return dirs, times, nil
+}
+
+// ExportCountMissing はマニフェストのエントリ(名前、エラー、robots.txtでスキップしたか)を集計して、
+// 欠けているデータとスキップしたデータの名前ごとの数を返す
+func ExportCountMissing(entries [][3]string, expected []string) (map[string]int, map[string]int) {
+	var es []manifestEntry
+	for _, e := range entries {
+		es = append(es, manifestEntry{Name: e[0], Error: e[1], Skipped: e[2] != ""})
+	}
+	d := newMissingData()
+	d.add(es, expected)
+	return d.missing, d.skipped
+}
@@ -0,0 +1,172 @@
+package source
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/pkg/errors"
+)
+
+// fetchごとの件数の履歴を記録するファイル名
+const healthFileName = "health.jsonl"
+
+// 件数の状態
+const (
+	healthOK        = "ok"
+	healthCollapsed = "collapsed"
+)
+
+// healthRecord は1回のfetchで得た1つの件数とベースラインとの比較結果を表す
+type healthRecord struct {
+	Time   string `json:"time"`
+	Source string `json:"source"`
+	// Filter は件数を絞り込んだ条件。条件が異なる履歴はベースラインに使わない
+	Filter string `json:"filter,omitempty"`
+	// Metric は件数の種類(boards、feeds、itemsなど)
+	Metric string `json:"metric"`
+	Count  int    `json:"count"`
+	// Baseline は直近の件数の中央値。履歴が無い場合は0
+	Baseline float64 `json:"baseline,omitempty"`
+	Status   string  `json:"status"`
+}
+
+// healthCheck は1回のfetchで得た板やフィード、記事の件数を集め、
+// 直近のfetchの件数の中央値(ローリングベースライン)と比較する。
+// スクレイピング対象のページの構造が変わって件数が激減した場合に、
+// 薄いデータで処理を続けずにエラーにするために使う。
+type healthCheck struct {
+	source string
+	// filter は板などの絞り込み条件。絞り込み条件ごとに別のベースラインと比較する
+	filter  string
+	metrics []string
+	counts  map[string]int
+}
+
+func newHealthCheck(source string) *healthCheck {
+	return &healthCheck{source: source, counts: make(map[string]int)}
+}
+
+// count はmetricの件数を記録する
+func (h *healthCheck) count(metric string, n int) {
+	if _, ok := h.counts[metric]; !ok {
+		h.metrics = append(h.metrics, metric)
+	}
+	h.counts[metric] = n
+}
+
+// check は opts.Dest/health.jsonl の履歴から件数ごとのベースラインを求めて比較し、結果をfetchの時刻で履歴に追記する。
+// リプレイの場合は同じレスポンスの件数で履歴が偏らないよう、比較だけを行って履歴には追記しない。
+// 件数が0になった場合か、ベースラインの opts.HealthThreshold 倍を下回った場合はエラーを返す。
+// 板やフィードを減らすなど意図して件数が変わった場合は、直近の履歴の半分を超えるとベースラインが追従する。
+func (h *healthCheck) check(opts FetchOptions) error {
+	if len(h.metrics) == 0 {
+		return nil
+	}
+	path := filepath.Join(opts.Dest, healthFileName)
+	history, err := readHealthRecords(path)
+	if err != nil {
+		return err
+	}
+
+	now := opts.now().Format(time.RFC3339)
+	var records []healthRecord
+	var collapsed []string
+	for _, metric := range h.metrics {
+		r := healthRecord{
+			Time:     now,
+			Source:   h.source,
+			Filter:   h.filter,
+			Metric:   metric,
+			Count:    h.counts[metric],
+			Baseline: baseline(history, h.source, h.filter, metric, opts.HealthWindow),
+			Status:   healthOK,
+		}
+		if opts.HealthThreshold > 0 && (r.Count == 0 || float64(r.Count) < r.Baseline*opts.HealthThreshold) {
+			r.Status = healthCollapsed
+			collapsed = append(collapsed, metric)
+		}
+		fmt.Printf("source health. source=%s filter=%q metric=%s count=%d baseline=%g status=%s\n",
+			r.Source, r.Filter, r.Metric, r.Count, r.Baseline, r.Status)
+		records = append(records, r)
+	}
+	if !opts.Replay {
+		if err := appendHealthRecords(path, records); err != nil {
+			return err
+		}
+	}
+	if len(collapsed) > 0 {
+		return errors.Errorf("%s fetch collapsed below %g of the baseline (the page structure may have changed): %v", h.source, opts.HealthThreshold, collapsed)
+	}
+	return nil
+}
+
+// 同じソースと絞り込み条件の履歴の直近window件の件数の中央値を返す。履歴が無い場合は0を返す
+func baseline(history []healthRecord, source, filter, metric string, window int) float64 {
+	var counts []int
+	for i := len(history) - 1; i >= 0 && (window <= 0 || len(counts) < window); i-- {
+		r := history[i]
+		if r.Source == source && r.Filter == filter && r.Metric == metric {
+			counts = append(counts, r.Count)
+		}
+	}
+	if len(counts) == 0 {
+		return 0
+	}
+	sort.Ints(counts)
+	mid := len(counts) / 2
+	if len(counts)%2 == 0 {
+		return float64(counts[mid-1]+counts[mid]) / 2
+	}
+	return float64(counts[mid])
+}
+
+// 件数の履歴を読み込む。ファイルが無い場合はnilを返す
+func readHealthRecords(path string) ([]healthRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to open file: %s", path)
+	}
+	defer f.Close()
+
+	var records []healthRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r healthRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse health records: %s", path)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read file: %s", path)
+	}
+	return records, nil
+}
+
+// 件数の履歴をpathに追記する
+func appendHealthRecords(path string, records []healthRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "failed to create directory: %s", filepath.Dir(path))
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open file: %s", path)
+	}
+	defer f.Close()
+
+	for _, r := range records {
+		if err := cmd.AppendOutFile(f, r); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(f.Sync(), "failed to sync file")
+}
@@ -0,0 +1,212 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/pkg/errors"
+)
+
+// fetch実行ごとに取得結果を記録するマニフェストのファイル名
+const manifestFileName = "manifest.jsonl"
+
+// manifestEntry は1つのURLの取得結果を表す
+type manifestEntry struct {
+	// Name は板IDやフィードIDなど取得したデータの名前
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	Bytes       int    `json:"bytes"`
+	SHA256      string `json:"sha256,omitempty"`
+	Duration    string `json:"duration"`
+	Retries     uint   `json:"retries"`
+	NotModified bool   `json:"not_modified,omitempty"`
+	// Skipped はrobots.txtで禁止されていて取得しなかった場合にtrueになる
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// manifest は1回のfetchで取得したURLの結果を集める
+type manifest struct {
+	mu      sync.Mutex
+	entries []manifestEntry
+}
+
+// fetch はurlを取得してfnに渡し、取得結果をマニフェストに記録する。
+// 取得とfnのどちらかが失敗した場合はエラーを記録して返す。
+func (m *manifest) fetch(ctx context.Context, c *fetch.Client, name, url string, fn func(res *fetch.Response) error) error {
+	start := time.Now()
+	res, err := c.Get(ctx, url)
+	e := manifestEntry{
+		Name:     name,
+		URL:      url,
+		Duration: time.Since(start).String(),
+	}
+	if res != nil {
+		sum := sha256.Sum256(res.Body)
+		e.StatusCode = res.StatusCode
+		e.Bytes = len(res.Body)
+		e.SHA256 = hex.EncodeToString(sum[:])
+		e.Retries = res.Retries
+		e.NotModified = res.NotModified
+	}
+	if err == nil {
+		err = fn(res)
+	}
+	if err != nil {
+		e.Skipped = errors.Is(err, fetch.ErrDisallowed)
+		e.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	m.entries = append(m.entries, e)
+	m.mu.Unlock()
+	return err
+}
+
+// write はマニフェストの全てのエントリをpathに追記する。
+// 取得に失敗したURLやrobots.txtで禁止されてスキップしたURLもエラーとともに出力し、transformでマニフェストから集計する。
+func (m *manifest) write(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.entries) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "failed to create directory: %s", filepath.Dir(path))
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open file: %s", path)
+	}
+	defer f.Close()
+
+	for _, e := range m.entries {
+		if err := cmd.AppendOutFile(f, e); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(f.Sync(), "failed to sync file")
+}
+
+// readManifest はdirのマニフェストを読み込む。
+// マニフェスト導入前のデータなどでファイルが無い場合はnilを返す。
+func readManifest(dir string) ([]manifestEntry, error) {
+	path := filepath.Join(dir, manifestFileName)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to open file: %s", path)
+	}
+	defer f.Close()
+
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e manifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse manifest: %s", path)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read file: %s", path)
+	}
+	return entries, nil
+}
+
+// missingData はターゲット日のスナップショットで欠けているデータを名前ごとに集計する
+type missingData struct {
+	snapshots int
+	// missing は名前ごとのデータが欠けているスナップショットの数
+	missing map[string]int
+	// skipped は名前ごとのrobots.txtで禁止されていて取得しなかったスナップショットの数
+	skipped map[string]int
+}
+
+func newMissingData() *missingData {
+	return &missingData{missing: make(map[string]int), skipped: make(map[string]int)}
+}
+
+// add はスナップショットのマニフェストから取得に失敗したデータを集計する。
+// expectedの名前がマニフェストに無い場合はfetchされなかったデータとして集計する。
+// robots.txtで禁止されていただけのデータは取得の失敗とは別に集計する。
+// マニフェストが無いスナップショットは集計しない。
+func (d *missingData) add(entries []manifestEntry, expected []string) {
+	if entries == nil {
+		return
+	}
+	d.snapshots++
+
+	// 板の移転などで同じ名前を取り直して成功した場合は欠けていないものとする
+	fetched := make(map[string]bool, len(entries))
+	succeeded := make(map[string]bool, len(entries))
+	failed := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		fetched[e.Name] = true
+		switch {
+		case e.Error == "":
+			succeeded[e.Name] = true
+		case !e.Skipped:
+			failed[e.Name] = true
+		}
+	}
+	for name := range fetched {
+		switch {
+		case succeeded[name]:
+		case failed[name]:
+			d.missing[name]++
+		default:
+			d.skipped[name]++
+		}
+	}
+	for _, name := range expected {
+		if !fetched[name] {
+			d.missing[name]++
+		}
+	}
+}
+
+// report は欠けているデータとrobots.txtでスキップしたデータがあれば、
+// それぞれ名前と欠けていたスナップショットの数をまとめて1行で出力する。
+// 欠けていた理由は各スナップショットのマニフェストに記録されている
+func (d *missingData) report(source, dateStr string) {
+	if len(d.missing) > 0 {
+		fmt.Printf("missing fetch data. source=%s date=%s snapshots=%d missing=%s\n",
+			source, dateStr, d.snapshots, countsByName(d.missing))
+	}
+	if len(d.skipped) > 0 {
+		fmt.Printf("fetch data skipped by robots.txt. source=%s date=%s snapshots=%d skipped=%s\n",
+			source, dateStr, d.snapshots, countsByName(d.skipped))
+	}
+}
+
+// 名前ごとの数を名前順に name(n) の形式でカンマ区切りにして返す
+func countsByName(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s := make([]string, len(names))
+	for i, name := range names {
+		s[i] = fmt.Sprintf("%s(%d)", name, counts[name])
+	}
+	return strings.Join(s, ",")
+}
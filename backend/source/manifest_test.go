@@ -0,0 +1,30 @@
+package source_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ohnishi/nahaha/backend/source"
+)
+
+func TestMissingData(t *testing.T) {
+	entries := [][3]string{
+		{"news", "", ""},
+		{"moved", "board moved", ""},
+		{"moved", "", ""},
+		{"failed", "503 Service Unavailable", ""},
+		{"robots", "disallowed by robots.txt", "skipped"},
+		{"mixed", "disallowed by robots.txt", "skipped"},
+		{"mixed", "503 Service Unavailable", ""},
+	}
+	missing, skipped := source.ExportCountMissing(entries, []string{"news", "unfetched"})
+
+	wantMissing := map[string]int{"failed": 1, "mixed": 1, "unfetched": 1}
+	if !reflect.DeepEqual(missing, wantMissing) {
+		t.Errorf("missing = %v, want %v", missing, wantMissing)
+	}
+	wantSkipped := map[string]int{"robots": 1}
+	if !reflect.DeepEqual(skipped, wantSkipped) {
+		t.Errorf("skipped = %v, want %v", skipped, wantSkipped)
+	}
+}
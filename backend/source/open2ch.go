@@ -0,0 +1,89 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"golang.org/x/net/html/charset"
+)
+
+// open2ch板一覧URL
+const open2chBoardListURL = "https://open2ch.net/bbsmenu.html"
+
+// open2ch はopen2chの板URLとsubject.txtの構成を表す。
+// URLの構成は5chと同じで、subject.txtはUTF-8で配信される
+var open2ch = bbsSite{name: "open2ch", layout: bbs.Nichannel}
+
+func init() {
+	Register(&open2chSource{})
+}
+
+// open2chSource はopen2chの板ごとのsubject.txtをニュースソースとして扱う
+type open2chSource struct {
+	concurrency     int
+	hostConcurrency int
+	boardList       string
+	filter          boardFilter
+}
+
+func (*open2chSource) Name() string { return "open2ch" }
+
+func (*open2chSource) Description() string { return "open2ch thread" }
+
+func (s *open2chSource) SetFetchFlags(f *pflag.FlagSet) {
+	f.IntVar(&s.concurrency, "concurrency", 8, "max number of subject.txt fetched concurrently")
+	f.IntVar(&s.hostConcurrency, "host-concurrency", 2, "max number of subject.txt fetched concurrently from the same host")
+	f.StringVar(&s.boardList, "board-list", open2chBoardListURL, "URL of the board list page")
+	f.StringSliceVar(&s.filter.IncludeCategories, "include-category", nil, "board category to fetch (all categories if empty)")
+	f.StringSliceVar(&s.filter.ExcludeCategories, "exclude-category", nil, "board category not to fetch")
+	f.StringSliceVar(&s.filter.Boards, "board", nil, "board ID to fetch (all boards if empty)")
+}
+
+// Fetch は板一覧ページから板を探し、各板のsubject.txtを opts.Dest/YYYYMMDD/hhmm に保存する
+func (s *open2chSource) Fetch(ctx context.Context, opts FetchOptions) error {
+	res, err := opts.Client.Get(ctx, s.boardList)
+	if err != nil {
+		return err
+	}
+	r, err := charset.NewReader(bytes.NewReader(res.Body), res.Header.Get("Content-Type"))
+	if err != nil {
+		return errors.Wrapf(err, "failed to detect charset: %s", s.boardList)
+	}
+	links, err := getLinks(r)
+	if err != nil {
+		return err
+	}
+
+	var targets []link
+	for _, l := range links {
+		if isOpen2chBoard(l.href) && s.filter.match(l) {
+			targets = append(targets, l)
+		}
+	}
+	if len(targets) == 0 {
+		return errors.Errorf("no open2ch board found: %s", s.boardList)
+	}
+	return fetchBBS(ctx, opts, open2ch, &manifest{}, nil, targets, s.filter.key(), newFetchPool(s.concurrency, s.hostConcurrency))
+}
+
+// Transform はfetchしたsubject.txtからターゲット日に作成されたopen2chスレッドを抽出する
+func (*open2chSource) Transform(ctx context.Context, src, dest string, date time.Time) error {
+	return transformBBS(ctx, open2ch, src, dest, date)
+}
+
+// 板一覧のリンクURLがopen2chの板URLならtrueを返す
+// 板一覧にはまとめやヘルプなど板以外へのリンクも含まれるため、板のサブドメインで1階層のURLのみを対象にする
+func isOpen2chBoard(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil || !strings.HasSuffix(u.Hostname(), ".open2ch.net") {
+		return false
+	}
+	id, err := open2ch.layout.BoardID(href)
+	return err == nil && !strings.Contains(id, ".")
+}
@@ -0,0 +1,204 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/command"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"golang.org/x/net/html/charset"
+)
+
+func init() {
+	Register(&openGraphSource{})
+}
+
+// openGraphSource はトレンドにランクインした記事のページからOpenGraphのメタデータを取得して記事情報に付与する
+type openGraphSource struct {
+	trends          string
+	concurrency     int
+	hostConcurrency int
+}
+
+func (*openGraphSource) Name() string { return "opengraph" }
+
+func (*openGraphSource) Description() string { return "OpenGraph metadata of articles in trends" }
+
+func (s *openGraphSource) SetFetchFlags(f *pflag.FlagSet) {
+	f.StringVar(&s.trends, "trends", "", "trends json whose articles are enriched")
+	f.IntVar(&s.concurrency, "concurrency", 8, "max number of article pages fetched concurrently")
+	f.IntVar(&s.hostConcurrency, "host-concurrency", 2, "max number of article pages fetched concurrently from the same host")
+}
+
+// Fetch は--trendsのトレンドJSONの記事ページを取得し、
+// OpenGraphのメタデータを付与したトレンドJSONを opts.Dest/<トレンドJSONのファイル名> に保存する
+func (s *openGraphSource) Fetch(ctx context.Context, opts FetchOptions) error {
+	if s.trends == "" {
+		return command.NewFlagErrorf("--trends is required")
+	}
+	var content cmd.Content
+	if err := cmd.ReadFileJSON(s.trends, &content); err != nil {
+		return errors.Wrapf(err, "failed to read trends: %s", s.trends)
+	}
+
+	// 同じ記事が複数のワードにランクインしていても1回だけ取得する
+	var urls []string
+	seen := make(map[string]bool)
+	for _, item := range content.Items {
+		for _, a := range item.Articles {
+			if !seen[a.URL] {
+				seen[a.URL] = true
+				urls = append(urls, a.URL)
+			}
+		}
+	}
+
+	m := &manifest{}
+	results := make([]*openGraph, len(urls))
+	pool := newFetchPool(s.concurrency, s.hostConcurrency)
+	pool.each(len(urls), func(i int) string {
+		return hostOf(urls[i])
+	}, func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+		// 記事ページの取得に失敗しても処理は止めずに、マニフェストに記録した結果から後で確認する
+		_ = m.fetch(ctx, opts.Client, urls[i], urls[i], func(res *fetch.Response) error {
+			og, err := parseOpenGraph(res.Body, res.Header.Get("Content-Type"), res.URL)
+			if err != nil {
+				return err
+			}
+			results[i] = &og
+			return nil
+		})
+	})
+	if err := m.write(filepath.Join(opts.Dest, manifestFileName)); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "fetch OpenGraph was canceled")
+	}
+
+	ogs := make(map[string]openGraph, len(urls))
+	for i, og := range results {
+		if og != nil {
+			ogs[urls[i]] = *og
+		}
+	}
+	for i := range content.Items {
+		for j, a := range content.Items[i].Articles {
+			if og, ok := ogs[a.URL]; ok {
+				content.Items[i].Articles[j] = og.apply(a)
+			}
+		}
+	}
+
+	f, err := cmd.CreateOutFile(filepath.Join(opts.Dest, filepath.Base(s.trends)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := cmd.AppendOutFile(f, content); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+// openGraph は記事ページから抽出したメタデータを表す
+type openGraph struct {
+	title        string
+	description  string
+	image        string
+	canonicalURL string
+	publishedAt  string
+}
+
+// apply は抽出したメタデータを記事情報に付与して返す
+func (og openGraph) apply(a cmd.Article) cmd.Article {
+	a.OGTitle = og.title
+	a.Description = og.description
+	a.Image = og.image
+	a.CanonicalURL = og.canonicalURL
+	a.PublishedAt = og.publishedAt
+	return a
+}
+
+// 公開日時を表すメタデータのセレクタ。先に見つかったものを使う
+var publishedTimeSelectors = []string{
+	`meta[property="article:published_time"]`,
+	`meta[itemprop="datePublished"]`,
+	`meta[name="pubdate"]`,
+}
+
+// 記事ページのHTMLからOpenGraphのメタデータとcanonical URL、公開日時を抽出する
+// 文字コードはContent-TypeとHTMLのmetaから判定し、相対URLはpageURLを基準に解決する
+func parseOpenGraph(b []byte, contentType, pageURL string) (openGraph, error) {
+	var og openGraph
+	r, err := charset.NewReader(bytes.NewReader(b), contentType)
+	if err != nil {
+		return og, errors.Wrapf(err, "failed to detect charset: %s", pageURL)
+	}
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return og, errors.Wrapf(err, "failed parse response body : %s", pageURL)
+	}
+
+	meta := func(selector string) string {
+		v, _ := doc.Find(selector).First().Attr("content")
+		return strings.TrimSpace(v)
+	}
+	og.title = meta(`meta[property="og:title"]`)
+	og.description = meta(`meta[property="og:description"]`)
+	if og.description == "" {
+		og.description = meta(`meta[name="description"]`)
+	}
+	og.image = resolveURL(pageURL, meta(`meta[property="og:image"]`))
+
+	canonical, _ := doc.Find(`link[rel="canonical"]`).First().Attr("href")
+	if canonical == "" {
+		canonical = meta(`meta[property="og:url"]`)
+	}
+	og.canonicalURL = resolveURL(pageURL, strings.TrimSpace(canonical))
+
+	for _, selector := range publishedTimeSelectors {
+		if v := meta(selector); v != "" {
+			og.publishedAt = toRFC3339(v)
+			break
+		}
+	}
+	return og, nil
+}
+
+// refをbaseを基準に解決したURLを返す。解決できない場合はrefをそのまま返す
+func resolveURL(base, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	u, err := b.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// 日時の文字列をRFC3339に変換する。パースできない場合は元の文字列を返す
+func toRFC3339(s string) string {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return s
+}
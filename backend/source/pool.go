@@ -0,0 +1,62 @@
+package source
+
+import (
+	"net/url"
+	"sync"
+)
+
+// fetchPool は全体の同時実行数とホストごとの同時実行数を制限してタスクを並行実行する
+type fetchPool struct {
+	concurrency     int
+	hostConcurrency int
+}
+
+// newFetchPool はfetchPoolを生成する。
+// 0以下の同時実行数が指定された場合は1として扱う。
+func newFetchPool(concurrency, hostConcurrency int) *fetchPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if hostConcurrency < 1 {
+		hostConcurrency = 1
+	}
+	return &fetchPool{concurrency: concurrency, hostConcurrency: hostConcurrency}
+}
+
+// each は0からn-1までのインデックスごとにfnを並行実行し、全て終了するまで待つ。
+// hostはインデックスに対応するタスクの接続先ホストを返す。
+func (p *fetchPool) each(n int, host func(int) string, fn func(int)) {
+	global := make(chan struct{}, p.concurrency)
+	hosts := make(map[string]chan struct{})
+	for i := 0; i < n; i++ {
+		h := host(i)
+		if _, ok := hosts[h]; !ok {
+			hosts[h] = make(chan struct{}, p.hostConcurrency)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// ホストの枠を先に確保することで、同じホストの順番待ちが全体の枠を塞がないようにする
+			hs := hosts[host(i)]
+			hs <- struct{}{}
+			defer func() { <-hs }()
+			global <- struct{}{}
+			defer func() { <-global }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// URL文字列からホスト名を返す。パースできない場合は文字列をそのまま返す
+func hostOf(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	return u.Host
+}
@@ -0,0 +1,75 @@
+package source
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	Register(rssSource{})
+}
+
+// rssSource はrss.jsonlに登録されたRSSフィードをニュースソースとして扱う
+type rssSource struct{}
+
+func (rssSource) Name() string { return "rss" }
+
+func (rssSource) Description() string { return "rss thread" }
+
+func (rssSource) Fetch(ctx context.Context, opts FetchOptions) error {
+	return fetchNewsRSS(ctx, opts)
+}
+
+// fetchNewsRSS ニュースソースとなるRSSを保存する
+func fetchNewsRSS(ctx context.Context, opts FetchOptions) error {
+	feeds, err := cmd.ReadFeeds(cmd.FeedListPath(opts.Src))
+	if err != nil {
+		return errors.WithMessage(err, "failed to read rss.json")
+	}
+
+	destDir := snapshotDir(opts.Dest, opts.now())
+	m := &manifest{}
+	fetched, items := 0, 0
+	for _, feed := range feeds {
+		if !feed.Enabled {
+			continue
+		}
+		// RSSの取得に失敗しても処理は止めずに、マニフェストに記録した結果から後で確認する
+		if n, err := request(ctx, opts, m, destDir, feed); err == nil {
+			fetched++
+			items += n
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if err := m.write(filepath.Join(destDir, manifestFileName)); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "fetch RSS was canceled")
+	}
+
+	h := newHealthCheck("rss")
+	h.count("feeds", fetched)
+	h.count("items", items)
+	return h.check(opts)
+}
+
+// フィードを取得して保存し、フィードの記事数を返す
+func request(ctx context.Context, opts FetchOptions, m *manifest, out string, feed cmd.Feed) (int, error) {
+	var parsed *gofeed.Feed
+	err := m.fetch(ctx, opts.Client, feed.ID, feed.URL, func(res *fetch.Response) error {
+		// エラーページや空のボディで前回のRSSを置き換えないよう、フィードとしてパースできることを確認してから保存する
+		return opts.saveValidated(feedValidator(&parsed), res.Header.Get("Content-Type"), res.Body, filepath.Join(out, feed.ID))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(parsed.Items), nil
+}
@@ -0,0 +1,172 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// newsArticleJSON transformしたニュース記事データ
+type newsArticleJSON struct {
+	Date      string  `json:"date"`
+	URL       string  `json:"url"`
+	Name      string  `json:"name"`
+	Title     string  `json:"title"`
+	Category  string  `json:"category,omitempty"`
+	Weight    float64 `json:"weight,omitempty"`
+	Language  string  `json:"language,omitempty"`
+	FirstSeen string  `json:"first_seen"`
+	LastSeen  string  `json:"last_seen"`
+	ResCount  int     `json:"res_count,omitempty"`
+	Momentum  float64 `json:"momentum,omitempty"`
+}
+
+func (rssSource) Transform(ctx context.Context, src, dest string, date time.Time) error {
+	return transformRSS(ctx, src, dest, date)
+}
+
+// transformRSS fetchしたRSSファイルからターゲット日に更新された記事を抽出する
+func transformRSS(ctx context.Context, src, dest string, date time.Time) error {
+	feeds, err := cmd.ReadFeeds(cmd.FeedListPath(src))
+	if err != nil {
+		return errors.WithMessage(err, "failed to read rss.json")
+	}
+
+	dateStr := date.Format("20060102")
+	articleMap, err := toArticleMap(ctx, feeds, src, dateStr, date)
+	if err != nil {
+		return err
+	}
+
+	return writeArticleJSOL(dest, dateStr, "rss.jsonl", articleMap)
+}
+
+// RSS設定JSONとfetchしたRSSファイルからターゲット日付のニュース記事を抽出して保存する
+// ターゲット日の全スナップショットをマージし、記事ごとに初出・最終確認時刻を記録する
+// マニフェストから取得に失敗したフィードとfetchされなかったフィードを集計して出力する
+func toArticleMap(ctx context.Context, feeds []cmd.Feed, src, dateStr string, date time.Time) (map[string]newsArticleJSON, error) {
+	snapshots, err := listSnapshots(src, dateStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, feed := range feeds {
+		if feed.Enabled {
+			ids = append(ids, feed.ID)
+		}
+	}
+
+	m := make(map[string]newsArticleJSON)
+	missing := newMissingData()
+	for _, ss := range snapshots {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, "transform RSS was canceled")
+		}
+		entries, err := readManifest(ss.dir)
+		if err != nil {
+			return nil, err
+		}
+		missing.add(entries, ids)
+		for _, feed := range feeds {
+			if !feed.Enabled {
+				continue
+			}
+			if err := mergeFeedArticles(m, feed, filepath.Join(ss.dir, feed.ID), ss.time, dateStr, date); err != nil {
+				return nil, err
+			}
+		}
+	}
+	missing.report("rss", dateStr)
+	return m, nil
+}
+
+// fetchしたRSSファイルからターゲット日付のニュース記事を抽出してmにマージする
+// 記事にはフィード定義のカテゴリ、重み、言語を付与する
+func mergeFeedArticles(m map[string]newsArticleJSON, def cmd.Feed, filePath string, seenAt time.Time, dateStr string, date time.Time) error {
+	rss, err := cmd.OpenFile(filePath)
+	if os.IsNotExist(err) {
+		// RSSリストが更新されてfetchファイルが存在しないケース
+		return nil
+	}
+	if err != nil {
+		// RSSファイルの読み込み失敗しても処理は止めずに warnnig log を出力する
+		fmt.Println("failed to open RSS file.", zap.String("path", filePath), zap.Error(err))
+		return nil
+	}
+
+	gfp := gofeed.NewParser()
+	feed, parseErr := gfp.Parse(rss)
+	closeErr := rss.Close()
+	if closeErr != nil {
+		return errors.Wrapf(closeErr, "failed to close a rss reader: %s", filePath)
+	}
+	if parseErr != nil {
+		// RSSの解析に失敗しても処理は止めずに warnnig log を出力する
+		fmt.Println("failed to parse RSS.", zap.String("path", filePath), zap.Error(parseErr))
+		return nil
+	}
+	for _, item := range feed.Items {
+		if json, ok := m[item.Link]; ok {
+			json.seen(seenAt)
+			m[item.Link] = json
+			continue
+		}
+
+		var articleDate time.Time
+		if item.PublishedParsed != nil {
+			articleDate = item.PublishedParsed.In(time.Local)
+		} else if item.UpdatedParsed != nil {
+			articleDate = item.UpdatedParsed.In(time.Local)
+		} else {
+			articleDate = date
+		}
+		if dateStr != articleDate.Format("20060102") {
+			continue
+		}
+
+		language := def.Language
+		if language == "" {
+			language = feed.Language
+		}
+		json := newsArticleJSON{
+			Date:     articleDate.Format(time.RFC3339),
+			URL:      item.Link,
+			Name:     feed.Title,
+			Title:    item.Title,
+			Category: def.Category,
+			Weight:   def.Weight,
+			Language: language,
+		}
+		json.seen(seenAt)
+		m[item.Link] = json
+	}
+	return nil
+}
+
+// ニュース記事データをファイルに保存します
+func writeArticleJSOL(out, date, fileName string, m map[string]newsArticleJSON) error {
+	if len(m) == 0 {
+		return nil
+	}
+	f, err := cmd.CreateOutFile(filepath.Join(out, date, fileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, json := range m {
+		err = cmd.AppendOutFile(f, json)
+		if err != nil {
+			return err
+		}
+	}
+	return f.Commit()
+}
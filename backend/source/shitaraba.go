@@ -0,0 +1,153 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+	"github.com/ohnishi/nahaha/backend/common/command"
+	"github.com/ohnishi/nahaha/backend/common/env"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// shitaraba はしたらば掲示板の板URLとsubject.txtの構成を表す
+var shitaraba = bbsSite{name: "shitaraba", layout: bbs.Shitaraba, encoding: japanese.EUCJP}
+
+func init() {
+	Register(&shitarabaSource{})
+}
+
+// shitarabaSource はしたらば掲示板の板ごとのsubject.txtをニュースソースとして扱う。
+// したらばには全体の板一覧が無いため、対象の板は設定ファイルかフラグで指定する
+type shitarabaSource struct {
+	concurrency     int
+	hostConcurrency int
+	config          string
+	boards          []string
+}
+
+// shitarabaConfig はfetch対象のしたらば掲示板の板の設定を表す
+type shitarabaConfig struct {
+	// Boards は板URL(https://jbbs.shitaraba.net/<カテゴリ>/<板番号>/)の一覧
+	Boards []string `json:"boards"`
+}
+
+func (*shitarabaSource) Name() string { return "shitaraba" }
+
+func (*shitarabaSource) Description() string { return "Shitaraba thread" }
+
+func (s *shitarabaSource) SetFetchFlags(f *pflag.FlagSet) {
+	f.IntVar(&s.concurrency, "concurrency", 4, "max number of subject.txt fetched concurrently")
+	f.IntVar(&s.hostConcurrency, "host-concurrency", 1, "max number of subject.txt fetched concurrently from the same host")
+	f.StringVar(&s.config, "config", env.ConfigDir("nahaha", "shitaraba.json"), "json file of boards to fetch")
+	f.StringSliceVar(&s.boards, "board", nil, "board URL to fetch in addition to the boards in --config")
+}
+
+// Fetch は指定された板の設定(SETTING.TXT)から板名とカテゴリを取得し、
+// 各板のsubject.txtを opts.Dest/YYYYMMDD/hhmm/<カテゴリ>/<板番号> に保存する
+func (s *shitarabaSource) Fetch(ctx context.Context, opts FetchOptions) error {
+	config, err := readShitarabaConfig(s.config)
+	if err != nil {
+		return err
+	}
+	boards := append(config.Boards, s.boards...)
+	if len(boards) == 0 {
+		return command.NewFlagErrorf("no board to fetch: specify --board or boards in %s", s.config)
+	}
+	for _, b := range boards {
+		if _, err := shitaraba.layout.BoardID(b); err != nil {
+			return command.NewFlagErrorf("invalid board URL: %s", b)
+		}
+	}
+
+	pool := newFetchPool(s.concurrency, s.hostConcurrency)
+	links := make([]link, len(boards))
+	pool.each(len(boards), func(i int) string {
+		return hostOf(boards[i])
+	}, func(i int) {
+		links[i] = shitarabaBoardLink(ctx, opts.Client, boards[i])
+	})
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "fetch shitaraba was canceled")
+	}
+	// --boardで追加した板がある場合は、設定ファイルの板だけの履歴とは分けて比較する
+	return fetchBBS(ctx, opts, shitaraba, &manifest{}, nil, links, boardFilter{Boards: s.boards}.key(), pool)
+}
+
+// Transform はfetchしたsubject.txtからターゲット日に作成されたしたらば掲示板のスレッドを抽出する
+func (*shitarabaSource) Transform(ctx context.Context, src, dest string, date time.Time) error {
+	return transformBBS(ctx, shitaraba, src, dest, date)
+}
+
+// JSONファイルからfetch対象の板を読み込む。ファイルが存在しない場合は空の設定を返す
+func readShitarabaConfig(path string) (shitarabaConfig, error) {
+	var config shitarabaConfig
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, errors.Wrapf(err, "failed to read file: %s", path)
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, errors.Wrapf(err, "failed to unmarshal json: %s", path)
+	}
+	return config, nil
+}
+
+// 板の設定(SETTING.TXT)を取得して板一覧のリンクとして返す
+// SETTING.TXTは板名とカテゴリのためのメタデータなので、取得結果はデータのマニフェストには記録しない。
+// 設定を取得できない場合は板IDを板名として扱う
+func shitarabaBoardLink(ctx context.Context, c *fetch.Client, boardURL string) link {
+	boardID, _ := shitaraba.layout.BoardID(boardURL)
+	l := link{text: boardID, href: boardURL}
+
+	u, err := url.Parse(boardURL)
+	if err != nil {
+		return l
+	}
+	u.Path = "/bbs/api/setting.cgi/" + boardID + "/"
+	res, err := c.Get(ctx, u.String())
+	if err != nil {
+		fmt.Printf("failed to fetch SETTING.TXT. url=%s error=%v\n", u.String(), err)
+		return l
+	}
+	setting, err := parseShitarabaSetting(res.Body)
+	if err != nil {
+		fmt.Printf("failed to parse SETTING.TXT. url=%s error=%v\n", u.String(), err)
+		return l
+	}
+	if title := setting["BBS_TITLE"]; title != "" {
+		l.text = title
+	}
+	l.category = setting["CATEGORY"]
+	return l
+}
+
+// EUC-JPのSETTING.TXT(KEY=VALUEの行)をパースして返す
+func parseShitarabaSetting(b []byte) (map[string]string, error) {
+	setting := make(map[string]string)
+	scanner := bufio.NewScanner(transform.NewReader(bytes.NewReader(b), japanese.EUCJP.NewDecoder()))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) == 2 {
+			setting[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return setting, nil
+}
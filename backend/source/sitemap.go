@@ -0,0 +1,156 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/ohnishi/nahaha/backend/common/sitemap"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	Register(&sitemapSource{})
+}
+
+// sitemapSource はsitemap.jsonlに登録されたGoogle News形式のサイトマップをニュースソースとして扱う
+type sitemapSource struct {
+	maxSitemaps int
+}
+
+func (*sitemapSource) Name() string { return "sitemap" }
+
+func (*sitemapSource) Description() string { return "news sitemap" }
+
+func (s *sitemapSource) SetFetchFlags(f *pflag.FlagSet) {
+	f.IntVar(&s.maxSitemaps, "max-sitemaps", 5, "max number of sitemaps fetched from each sitemap index (newest lastmod first)")
+}
+
+// Fetch はopts.Src/sitemap.jsonlのサイトマップを取得して opts.Dest/YYYYMMDD/hhmm/<ID>/<連番>.xml に保存する
+// サイトマップインデックスの場合は、lastmodが新しい順に子のサイトマップを取得する
+func (s *sitemapSource) Fetch(ctx context.Context, opts FetchOptions) error {
+	sitemaps, err := cmd.ReadFeeds(cmd.SitemapListPath(opts.Src))
+	if err != nil {
+		return errors.WithMessage(err, "failed to read sitemap.jsonl")
+	}
+
+	destDir := snapshotDir(opts.Dest, opts.now())
+	m := &manifest{}
+	fetched, items := 0, 0
+	for _, def := range sitemaps {
+		if !def.Enabled {
+			continue
+		}
+		// サイトマップの取得に失敗しても処理は止めずに、マニフェストに記録した結果から後で確認する
+		if n, err := s.fetchSitemap(ctx, opts, m, filepath.Join(destDir, def.ID), def); err == nil {
+			fetched++
+			items += n
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if err := m.write(filepath.Join(destDir, manifestFileName)); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "fetch sitemap was canceled")
+	}
+
+	h := newHealthCheck("sitemap")
+	h.count("sitemaps", fetched)
+	h.count("items", items)
+	return h.check(opts)
+}
+
+// サイトマップを取得してoutに保存し、保存したサイトマップの記事数を返す
+// サイトマップインデックスの場合は子のサイトマップを取得して保存し、1つも保存できなければエラーを返す
+func (s *sitemapSource) fetchSitemap(ctx context.Context, opts FetchOptions, m *manifest, out string, def cmd.Feed) (int, error) {
+	var children []sitemap.Sitemap
+	items := 0
+	err := m.fetch(ctx, opts.Client, def.ID, def.URL, func(res *fetch.Response) error {
+		b, doc, err := parseSitemap(res.Body, def.URL)
+		if err != nil {
+			// パースできないボディはエラーページなどとして隔離する
+			return opts.quarantine(res.Body, filepath.Join(out, "0.xml"), err)
+		}
+		if doc.IsIndex() {
+			children = doc.Sitemaps
+			return nil
+		}
+		items += countNewsItems(doc)
+		return opts.save(b, filepath.Join(out, "0.xml"))
+	})
+	if err != nil || len(children) == 0 {
+		return items, err
+	}
+
+	// ニュースサイトマップは新しい記事のものほどlastmodが新しいので、新しい順に上限まで取得する
+	lastMod := func(sm sitemap.Sitemap) time.Time {
+		// lastmodが無いかパースできない場合は最も古いものとして扱う
+		t, _ := sitemap.ParseDate(sm.LastMod, time.Local)
+		return t
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return lastMod(children[i]).After(lastMod(children[j]))
+	})
+	if s.maxSitemaps > 0 && len(children) > s.maxSitemaps {
+		children = children[:s.maxSitemaps]
+	}
+	saved := 0
+	for i, child := range children {
+		if ctx.Err() != nil {
+			break
+		}
+		name := fmt.Sprintf("%s/%d", def.ID, i)
+		// 子のサイトマップの取得に失敗しても残りの取得は続け、結果はマニフェストに記録する
+		err := m.fetch(ctx, opts.Client, name, child.Loc, func(res *fetch.Response) error {
+			b, doc, err := parseSitemap(res.Body, child.Loc)
+			if err != nil {
+				return opts.quarantine(res.Body, filepath.Join(out, fmt.Sprintf("%d.xml", i)), err)
+			}
+			if doc.IsIndex() {
+				return errors.Errorf("nested sitemap index is not supported: %s", child.Loc)
+			}
+			items += countNewsItems(doc)
+			return opts.save(b, filepath.Join(out, fmt.Sprintf("%d.xml", i)))
+		})
+		if err == nil {
+			saved++
+		}
+	}
+	if saved == 0 {
+		return items, errors.Errorf("no child sitemap of the sitemap index was saved: %s", def.URL)
+	}
+	return items, nil
+}
+
+// news:titleを持つURLの数を返す
+func countNewsItems(doc *sitemap.Document) int {
+	n := 0
+	for _, u := range doc.URLs {
+		if u.News != nil && strings.TrimSpace(u.News.Title) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// gzipで圧縮されていれば展開したサイトマップとパースした結果を返す
+func parseSitemap(body []byte, url string) ([]byte, *sitemap.Document, error) {
+	b, err := sitemap.Decompress(body)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, url)
+	}
+	doc, err := sitemap.Parse(b)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, url)
+	}
+	return b, doc, nil
+}
@@ -0,0 +1,142 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/sitemap"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+func (*sitemapSource) Transform(ctx context.Context, src, dest string, date time.Time) error {
+	return transformSitemap(ctx, src, dest, date)
+}
+
+// transformSitemap fetchしたニュースサイトマップからターゲット日に公開された記事を抽出する
+// 記事はtransformRSSと同じ形式で <dest>/YYYYMMDD/sitemap.jsonl に保存する
+func transformSitemap(ctx context.Context, src, dest string, date time.Time) error {
+	sitemaps, err := cmd.ReadFeeds(cmd.SitemapListPath(src))
+	if err != nil {
+		return errors.WithMessage(err, "failed to read sitemap.jsonl")
+	}
+
+	var ids []string
+	for _, def := range sitemaps {
+		if def.Enabled {
+			ids = append(ids, def.ID)
+		}
+	}
+
+	dateStr := date.Format("20060102")
+	snapshots, err := listSnapshots(src, dateStr)
+	if err != nil {
+		return err
+	}
+
+	m := make(map[string]newsArticleJSON)
+	missing := newMissingData()
+	for _, ss := range snapshots {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrap(err, "transform sitemap was canceled")
+		}
+		entries, err := readManifest(ss.dir)
+		if err != nil {
+			return err
+		}
+		missing.add(entries, ids)
+		for _, def := range sitemaps {
+			if !def.Enabled {
+				continue
+			}
+			if err := mergeSitemapArticles(m, def, filepath.Join(ss.dir, def.ID), ss.time, dateStr); err != nil {
+				return err
+			}
+		}
+	}
+	missing.report("sitemap", dateStr)
+
+	return writeArticleJSOL(dest, dateStr, "sitemap.jsonl", m)
+}
+
+// fetchしたサイトマップのディレクトリからターゲット日に公開された記事を抽出してmにマージする
+// news:titleの無いURLは記事として扱わない。記事にはサイトマップ定義のカテゴリ、重み、言語を付与する
+func mergeSitemapArticles(m map[string]newsArticleJSON, def cmd.Feed, dir string, seenAt time.Time, dateStr string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		// サイトマップ一覧が更新されてfetchファイルが存在しないケース
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read directory: %s", dir)
+	}
+
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, info.Name())
+		b, err := cmd.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read file: %s", path)
+		}
+		doc, err := sitemap.Parse(b)
+		if err != nil {
+			// サイトマップの解析に失敗しても処理は止めずに warnnig log を出力する
+			fmt.Println("failed to parse sitemap.", zap.String("path", path), zap.Error(err))
+			continue
+		}
+
+		for _, u := range doc.URLs {
+			if u.News == nil || strings.TrimSpace(u.News.Title) == "" {
+				continue
+			}
+			if json, ok := m[u.Loc]; ok {
+				json.seen(seenAt)
+				m[u.Loc] = json
+				continue
+			}
+
+			published := u.News.PublicationDate
+			if published == "" {
+				published = u.LastMod
+			}
+			articleDate, err := sitemap.ParseDate(published, time.Local)
+			if err != nil {
+				fmt.Println("unexpected publication date", zap.String("url", u.Loc), zap.Error(err))
+				continue
+			}
+			articleDate = articleDate.In(time.Local)
+			if dateStr != articleDate.Format("20060102") {
+				continue
+			}
+
+			name := u.News.Publication.Name
+			if name == "" {
+				name = def.Name
+			}
+			language := def.Language
+			if language == "" {
+				language = u.News.Publication.Language
+			}
+			json := newsArticleJSON{
+				Date:     articleDate.Format(time.RFC3339),
+				URL:      u.Loc,
+				Name:     name,
+				Title:    strings.TrimSpace(u.News.Title),
+				Category: def.Category,
+				Weight:   def.Weight,
+				Language: language,
+			}
+			json.seen(seenAt)
+			m[u.Loc] = json
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package source
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/common/core"
+	"github.com/pkg/errors"
+)
+
+// スナップショットディレクトリ名のフォーマット
+const snapshotFormat = "1504"
+
+// snapshot は1回のfetchで保存されたデータのディレクトリを表す
+type snapshot struct {
+	dir  string
+	time time.Time
+}
+
+// snapshotDir はfetch時刻tのデータを保存するディレクトリ <dest>/YYYYMMDD/hhmm を返す
+func snapshotDir(dest string, t time.Time) string {
+	return filepath.Join(dest, t.Format("20060102"), t.Format(snapshotFormat))
+}
+
+// listSnapshots はターゲット日のスナップショットを時刻順に返す。
+// スナップショット導入前に日付ディレクトリへ保存されたデータ(hhmm以外の名前のファイルやディレクトリ)も、
+// その中のファイルの最新の更新時刻のスナップショットとして先頭に含める。
+func listSnapshots(src, dateStr string) ([]snapshot, error) {
+	dayDir := filepath.Join(src, dateStr)
+	infos, err := ioutil.ReadDir(dayDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read directory: %s", dayDir)
+	}
+
+	var snapshots []snapshot
+	var legacyTime time.Time
+	for _, info := range infos {
+		path := filepath.Join(dayDir, info.Name())
+		if info.IsDir() {
+			if t, err := core.ParseLocal("20060102"+snapshotFormat, dateStr+info.Name()); err == nil {
+				snapshots = append(snapshots, snapshot{dir: path, time: t})
+				continue
+			}
+		}
+		// 旧形式のデータ(例: rss/topics/<ID>)
+		t, err := latestModTime(path)
+		if err != nil {
+			return nil, err
+		}
+		if t.After(legacyTime) {
+			legacyTime = t
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].time.Before(snapshots[j].time) })
+
+	if !legacyTime.IsZero() {
+		legacy := snapshot{dir: dayDir, time: legacyTime}
+		snapshots = append([]snapshot{legacy}, snapshots...)
+	}
+	return snapshots, nil
+}
+
+// path以下のファイルの最新の更新時刻を返す。ファイルが無い場合はゼロ値を返す
+func latestModTime(path string) (time.Time, error) {
+	var latest time.Time
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to walk directory: %s", path)
+	}
+	return latest, nil
+}
+
+// seen はスナップショットの時刻で記事の初出・最終確認時刻を更新する
+func (a *newsArticleJSON) seen(t time.Time) {
+	if first, err := time.Parse(time.RFC3339, a.FirstSeen); err != nil || t.Before(first) {
+		a.FirstSeen = t.Format(time.RFC3339)
+	}
+	if last, err := time.Parse(time.RFC3339, a.LastSeen); err != nil || t.After(last) {
+		a.LastSeen = t.Format(time.RFC3339)
+	}
+}
@@ -0,0 +1,137 @@
+package source_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/source"
+)
+
+// ファイルを作成して更新時刻をmodTimeにする
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListSnapshots(t *testing.T) {
+	legacyTime := time.Date(2020, 10, 31, 9, 30, 0, 0, time.Local)
+	tests := []struct {
+		name      string
+		files     map[string]time.Time
+		wantDirs  []string
+		wantTimes []time.Time
+	}{
+		{
+			name: "snapshots",
+			files: map[string]time.Time{
+				"20201031/1510/a":      legacyTime,
+				"20201031/0900/a":      legacyTime,
+				"20201031/0900/b/c":    legacyTime,
+				"20201101/0000/a":      legacyTime,
+				"20201031/0900/.tmp/x": legacyTime,
+			},
+			wantDirs: []string{"20201031/0900", "20201031/1510"},
+			wantTimes: []time.Time{
+				time.Date(2020, 10, 31, 9, 0, 0, 0, time.Local),
+				time.Date(2020, 10, 31, 15, 10, 0, 0, time.Local),
+			},
+		},
+		{
+			name: "legacy files in the day directory",
+			files: map[string]time.Time{
+				"20201031/news.txt":   legacyTime.Add(-time.Hour),
+				"20201031/sports.txt": legacyTime,
+			},
+			wantDirs:  []string{"20201031"},
+			wantTimes: []time.Time{legacyTime},
+		},
+		{
+			name: "legacy RSS layout with snapshots",
+			files: map[string]time.Time{
+				"20201031/rss/topics/top-picks":      legacyTime.Add(-time.Hour),
+				"20201031/rss/topics/domestic":       legacyTime,
+				"20201031/1200/rss/topics/top-picks": legacyTime,
+			},
+			wantDirs: []string{"20201031", "20201031/1200"},
+			wantTimes: []time.Time{
+				legacyTime,
+				time.Date(2020, 10, 31, 12, 0, 0, 0, time.Local),
+			},
+		},
+		{
+			name:  "no data",
+			files: map[string]time.Time{"20201101/0000/a": legacyTime},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			for name, modTime := range tt.files {
+				writeFile(t, filepath.Join(src, name), "", modTime)
+			}
+			dirs, times, err := source.ExportListSnapshots(src, "20201031")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var wantDirs []string
+			for _, d := range tt.wantDirs {
+				wantDirs = append(wantDirs, filepath.Join(src, d))
+			}
+			if len(dirs) != len(wantDirs) || len(dirs) > 0 && !reflect.DeepEqual(dirs, wantDirs) {
+				t.Errorf("dirs = %v, want %v", dirs, wantDirs)
+			}
+			if len(times) != len(tt.wantTimes) {
+				t.Fatalf("times = %v, want %v", times, tt.wantTimes)
+			}
+			for i := range times {
+				if !times[i].Equal(tt.wantTimes[i]) {
+					t.Errorf("times[%d] = %v, want %v", i, times[i], tt.wantTimes[i])
+				}
+			}
+		})
+	}
+}
+
+// スナップショット導入前の <src>/YYYYMMDD/rss/topics/<ID> に保存されたRSSもtransformできる
+func TestTransformLegacyRSS(t *testing.T) {
+	src, dest := t.TempDir(), t.TempDir()
+	legacyTime := time.Date(2020, 10, 31, 9, 30, 0, 0, time.Local)
+	writeFile(t, filepath.Join(src, "rss.jsonl"), `{"id":"rss/topics/top-picks","name":"Yahoo!ニュース","url":"https://news.yahoo.co.jp/rss/topics/top-picks.xml"}`+"\n", legacyTime)
+	writeFile(t, filepath.Join(src, "20201031", "rss", "topics", "top-picks"), `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><title>Yahoo!ニュース</title>
+<item><title>記事</title><link>https://news.yahoo.co.jp/pickup/1</link></item>
+</channel></rss>`, legacyTime)
+
+	s, ok := source.Lookup("rss")
+	if !ok {
+		t.Fatal("rss source is not registered")
+	}
+	date := time.Date(2020, 10, 31, 0, 0, 0, 0, time.Local)
+	if err := s.(source.Transformer).Transform(context.Background(), src, dest, date); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dest, "20201031", "rss.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "https://news.yahoo.co.jp/pickup/1") {
+		t.Errorf("legacy RSS article is not transformed: %s", b)
+	}
+	if !strings.Contains(string(b), legacyTime.Format(time.RFC3339)) {
+		t.Errorf("article is not seen at the legacy snapshot time: %s", b)
+	}
+}
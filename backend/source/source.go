@@ -0,0 +1,154 @@
+package source
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/fetch"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// Source はニュースソースを表す。
+// 各ソースはinitでRegisterを呼び出して自身を登録する。
+type Source interface {
+	// Name はソース名を返す。サブコマンド名として使われる。
+	Name() string
+	// Description はソースの説明を返す。
+	Description() string
+}
+
+// FetchOptions はfetch時の共通オプションを表す。
+type FetchOptions struct {
+	// Client はHTTPリクエストに使うクライアント
+	Client *fetch.Client
+	// Src はフィード一覧などの設定を読み込むディレクトリ
+	Src string
+	// Dest はfetchしたデータを保存するディレクトリ
+	Dest string
+	// NoRaw がtrueの場合はレスポンスボディをファイルに保存しない。
+	// WARCファイルのみにアーカイブする場合に使う。
+	NoRaw bool
+	// Gzip がtrueの場合はレスポンスボディをgzipで圧縮して拡張子 .gz を付けて保存する
+	Gzip bool
+	// QuarantineDir は検証に失敗したレスポンスボディを保存するディレクトリ。
+	// 空の場合は Dest/quarantine に保存する
+	QuarantineDir string
+	// HealthThreshold は板やフィード、記事の件数が直近の件数の中央値の何倍を下回ったらエラーにするか。
+	// 0の場合は件数を記録するだけでエラーにしない
+	HealthThreshold float64
+	// HealthWindow は中央値を求める直近の件数の数
+	HealthWindow int
+	// Time はfetchの時刻。スナップショットのディレクトリなどに使う。
+	// ゼロ値の場合は現在時刻。リプレイ時は記録した時刻を指定して記録した日のfetchを再現する
+	Time time.Time
+	// Replay がtrueの場合は記録したレスポンスのリプレイで、件数をベースラインと比較するだけで履歴には追記しない
+	Replay bool
+}
+
+// now はfetchの時刻を返す
+func (o FetchOptions) now() time.Time {
+	if o.Time.IsZero() {
+		return time.Now()
+	}
+	return o.Time
+}
+
+// Fetcher はニュースソースの生データをfetchするソースを表す。
+type Fetcher interface {
+	Source
+	// Fetch はopts.Srcの設定を元に生データをfetchしてopts.Destに保存する。
+	Fetch(ctx context.Context, opts FetchOptions) error
+}
+
+// FetchFlagSetter はソース固有のfetchフラグを持つソースを表す。
+type FetchFlagSetter interface {
+	// SetFetchFlags はfetchサブコマンドにソース固有のフラグをセットアップする。
+	SetFetchFlags(f *pflag.FlagSet)
+}
+
+// Transformer はfetchした生データをニュース記事データに変換するソースを表す。
+type Transformer interface {
+	Source
+	// Transform はsrcのfetchデータからターゲット日の記事を抽出してdestに保存する。
+	// ctxがキャンセルされた場合は途中で中断してエラーを返す。
+	Transform(ctx context.Context, src, dest string, date time.Time) error
+}
+
+var registry = map[string]Source{}
+
+// Register はソースを登録する。
+// 同じ名前のソースが既に登録されている場合はpanicする。
+func Register(s Source) {
+	if _, ok := registry[s.Name()]; ok {
+		panic("source: Register called twice for source " + s.Name())
+	}
+	registry[s.Name()] = s
+}
+
+// Lookup は名前に対応するソースを返す。
+func Lookup(name string) (Source, bool) {
+	s, ok := registry[name]
+	return s, ok
+}
+
+// Fetchers は登録されているFetcherを名前順に返す。
+func Fetchers() []Fetcher {
+	var fetchers []Fetcher
+	for _, s := range sources() {
+		if f, ok := s.(Fetcher); ok {
+			fetchers = append(fetchers, f)
+		}
+	}
+	return fetchers
+}
+
+// Transformers は登録されているTransformerを名前順に返す。
+func Transformers() []Transformer {
+	var transformers []Transformer
+	for _, s := range sources() {
+		if t, ok := s.(Transformer); ok {
+			transformers = append(transformers, t)
+		}
+	}
+	return transformers
+}
+
+func sources() []Source {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := make([]Source, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, registry[name])
+	}
+	return ret
+}
+
+// save はfetchしたレスポンスボディをファイルに保存する
+// NoRawが指定されている場合は保存せず、Gzipが指定されている場合は圧縮して path.gz に保存する
+func (o FetchOptions) save(body []byte, path string) error {
+	if o.NoRaw {
+		return nil
+	}
+	if o.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return errors.Wrapf(err, "failed to compress: %s", path)
+		}
+		if err := zw.Close(); err != nil {
+			return errors.Wrapf(err, "failed to compress: %s", path)
+		}
+		body = buf.Bytes()
+		path += cmd.GzipExt
+	}
+	return cmd.WriteOutFile(path, body)
+}
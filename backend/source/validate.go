@@ -0,0 +1,120 @@
+package source
+
+import (
+	"bytes"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/ohnishi/nahaha/backend/common/bbs"
+	"github.com/pkg/errors"
+)
+
+// 隔離ディレクトリが指定されていない場合に使う opts.Dest 直下のディレクトリ名
+const quarantineDirName = "quarantine"
+
+// validator はfetchしたレスポンスボディを保存する前に検証する条件を表す
+type validator struct {
+	// contentTypes が空でなければ、Content-Typeのメディアタイプがいずれかに一致する必要がある。
+	// Content-Typeが無いレスポンスは検証しない
+	contentTypes []string
+	// minSize はボディの最小サイズ
+	minSize int
+	// body がnilでなければボディの形式を検証する
+	body func(b []byte) error
+}
+
+// subject.txtの検証条件。HTMLのエラーページや移転案内、空のボディを拒否する
+var subjectValidator = validator{
+	contentTypes: []string{"text/plain"},
+	minSize:      1,
+	body:         bbs.ValidateSubject,
+}
+
+// RSS/Atom/JSON Feedの検証条件を返す。gofeedでパースでき、タイトルか記事があることを確認する
+// 検証できたフィードはparsedに入れて、保存後に記事数などを使えるようにする
+func feedValidator(parsed **gofeed.Feed) validator {
+	return validator{
+		minSize: 1,
+		body: func(b []byte) error {
+			feed, err := ParseFeed(b)
+			if err != nil {
+				return err
+			}
+			*parsed = feed
+			return nil
+		},
+	}
+}
+
+// validate はContent-Typeとボディが条件を満たさなければエラーを返す
+func (v validator) validate(contentType string, body []byte) error {
+	if len(v.contentTypes) > 0 && contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || !containsFold(v.contentTypes, mediaType) {
+			return errors.Errorf("unexpected content type: %s", contentType)
+		}
+	}
+	if len(body) < v.minSize {
+		return errors.Errorf("too small body: %d bytes", len(body))
+	}
+	if v.body != nil {
+		return v.body(body)
+	}
+	return nil
+}
+
+// saveValidated はvでボディを検証してからpathに保存する。
+// 検証に失敗したボディは前回までのファイルを置き換えずに隔離ディレクトリに保存し、エラーを返す
+func (o FetchOptions) saveValidated(v validator, contentType string, body []byte, path string) error {
+	if err := v.validate(contentType, body); err != nil {
+		return o.quarantine(body, path, err)
+	}
+	return o.save(body, path)
+}
+
+// quarantine はreasonで拒否したボディを隔離ディレクトリの opts.Dest からの相対パスと同じ場所に保存し、
+// 保存先を付けたreasonを返す。NoRawが指定されている場合は保存しない
+func (o FetchOptions) quarantine(body []byte, path string, reason error) error {
+	if o.NoRaw {
+		return errors.Wrap(reason, "rejected response")
+	}
+	dir := o.QuarantineDir
+	if dir == "" {
+		dir = filepath.Join(o.Dest, quarantineDirName)
+	}
+	rel, err := filepath.Rel(o.Dest, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(path)
+	}
+	qpath := filepath.Join(dir, rel)
+	if err := cmd.WriteOutFile(qpath, body); err != nil {
+		return errors.Wrapf(reason, "rejected response (failed to quarantine: %v)", err)
+	}
+	return errors.Wrapf(reason, "rejected response was quarantined to %s", qpath)
+}
+
+// ParseFeed はレスポンスボディをRSS/Atom/JSON Feedとしてパースする。
+// gofeedは不完全なJSONもフィードとしてパースするため、タイトルも記事も無い場合はエラーにする
+func ParseFeed(b []byte) (*gofeed.Feed, error) {
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse feed")
+	}
+	if strings.TrimSpace(feed.Title) == "" && len(feed.Items) == 0 {
+		return nil, errors.New("neither title nor items in feed")
+	}
+	return feed, nil
+}
+
+// ssのいずれかにsが大文字小文字を区別せずに一致すればtrueを返す
+func containsFold(ss []string, s string) bool {
+	for _, v := range ss {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ohnishi/nahaha/backend/cmd"
+	"github.com/pkg/errors"
+	"github.com/saintfish/chardet"
+	"golang.org/x/net/html/charset"
+)
+
+const rssListURL = "https://news.yahoo.co.jp/rss"
+
+func init() {
+	Register(yahooSource{})
+}
+
+// yahooSource はYahoo!ニュースのRSS一覧ページからrss.jsonlを生成する
+type yahooSource struct{}
+
+func (yahooSource) Name() string { return "yahoo" }
+
+func (yahooSource) Description() string { return "yahoo thread" }
+
+func (yahooSource) Fetch(ctx context.Context, opts FetchOptions) error {
+	return fetchYahooRSS(ctx, opts)
+}
+
+func fetchYahooRSS(ctx context.Context, opts FetchOptions) error {
+	res, err := opts.Client.Get(ctx, rssListURL)
+	if err != nil {
+		return err
+	}
+	links, err := getYahooRSSFeeds(bytes.NewReader(res.Body))
+	if err != nil {
+		return err
+	}
+
+	// RSS一覧ページの構造が変わってフィードが激減した場合は、フィード一覧を更新せずにエラーにする
+	h := newHealthCheck("yahoo")
+	h.count("feeds", len(links))
+	if err := h.check(opts); err != nil {
+		return err
+	}
+	return saveYahooRSS(opts.Dest, links)
+}
+
+func getYahooRSSFeeds(r io.Reader) ([]link, error) {
+	buf, _ := ioutil.ReadAll(r)
+
+	// 文字コード判定
+	det := chardet.NewTextDetector()
+	detRslt, _ := det.DetectBest(buf)
+	// 文字コード変換
+	bReader := bytes.NewReader(buf)
+	reader, _ := charset.NewReaderLabel(detRslt.Charset, bReader)
+
+	doc, err := goquery.NewDocumentFromReader(reader)
+	if err != nil {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read response body")
+		}
+		return nil, errors.Wrapf(err, "failed parse response body : %s", string(b))
+	}
+
+	var links []link
+	doc.Find("a").Each(func(_ int, s *goquery.Selection) {
+		href, exists := s.Attr("href")
+		if exists && strings.HasPrefix(href, "/rss/") {
+			l := link{
+				text: s.Text(),
+				href: href,
+			}
+			links = append(links, l)
+		}
+	})
+	return links, nil
+}
+
+// Yahoo!ニュースのフィードをフィード一覧ファイルにマージして保存する
+// Yahoo!ニュース以外のフィードや手動で追加したフィードは残す
+func saveYahooRSS(out string, links []link) error {
+	if len(links) == 0 {
+		return nil
+	}
+	path := cmd.FeedListPath(out)
+	feeds, err := cmd.ReadFeeds(path)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+
+	existing := make(map[string]cmd.Feed)
+	for _, f := range feeds {
+		existing[f.ID] = f
+	}
+	for _, link := range links {
+		id := link.href[1 : len(link.href)-4]
+		if err := cmd.ValidateFeedID(id); err != nil {
+			// 保存先のディレクトリの外を指すリンクは登録しない
+			fmt.Printf("invalid yahoo feed link. href=%s error=%v\n", link.href, err)
+			continue
+		}
+		feed, ok := existing[id]
+		if !ok {
+			feed = cmd.NewFeed(id, "", "")
+			feed.Language = "ja"
+		}
+		// カテゴリや重みなど手動で設定したメタデータは残す
+		feed.Name = link.text
+		feed.URL = "https://news.yahoo.co.jp" + link.href
+		feeds = cmd.UpsertFeeds(feeds, feed)
+	}
+	return cmd.WriteFeeds(path, feeds)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -11,6 +12,9 @@ import (
 )
 
 func main() {
+	ctx, cancel := command.SignalContext(context.Background())
+	defer cancel()
+
 	var (
 		dates []string
 		src   string
@@ -22,7 +26,7 @@ func main() {
 		Long:  "Publish trends from json",
 		Args:  cobra.NoArgs,
 		RunE: command.WithLoggingE(func(cmd *cobra.Command, args []string) error {
-			return command.EachDate(dates, func(date time.Time) error {
+			return command.EachDateContext(cmd.Context(), dates, func(date time.Time) error {
 				return publishTrends(src, dest, date)
 			})
 		}),
@@ -39,7 +43,7 @@ func main() {
 
 	fmt.Printf("> %s\n", strings.Join(os.Args, " "))
 
-	err := rootCmd.Execute()
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		command.PrintErrorAndExit(err)
 	}
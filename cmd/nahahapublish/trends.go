@@ -50,8 +50,5 @@ func writeContent(dest string, date time.Time, content cmd.Content) error {
 		log.Fatal(err)
 	}
 
-	if err := f.Sync(); err != nil {
-		return errors.Wrap(err, "failed to sync file")
-	}
-	return nil
+	return f.Commit()
 }